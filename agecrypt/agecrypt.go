@@ -0,0 +1,132 @@
+// Package agecrypt provides a netrc.Crypter for files encrypted with age
+// (https://age-encryption.org), such as ~/.netrc.age, so that they can be
+// read and saved with the netrc package without ever writing the plaintext
+// to disk:
+//
+//	c, err := agecrypt.ParseIdentityFile(os.ExpandEnv("$HOME/.config/age/key.txt"))
+//	if err != nil { ... }
+//	n, err := netrc.ParseFileWithOptions(path, netrc.ParseFileOptions{Crypter: c})
+//	if err != nil { ... }
+//	n.FindMachine("example.com").UpdatePassword(newpass)
+//	err = n.Save() // re-encrypted for c.Recipients
+package agecrypt // import "toolman.org/file/netrc/agecrypt"
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+const (
+	binaryHeader = "age-encryption.org/v1\n"
+	armorHeader  = armor.Header + "\n"
+)
+
+// Crypter is a netrc.Crypter for age files. Both the binary and the ASCII
+// armored formats can be decrypted.
+type Crypter struct {
+	// Identities are used to decrypt files.
+	Identities []age.Identity
+
+	// Recipients are the recipients files are encrypted to when saved.
+	// An age file does not record who it was encrypted to, so to keep a
+	// file shared with others readable by them, their recipients must be
+	// included here as well as one for Identities.
+	Recipients []age.Recipient
+
+	// Armor causes files to be saved in the ASCII armored format.
+	Armor bool
+}
+
+// Passphrase returns a Crypter that decrypts and encrypts files with
+// passphrase, as with "age --passphrase".
+func Passphrase(passphrase string) (*Crypter, error) {
+	id, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	r, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return &Crypter{Identities: []age.Identity{id}, Recipients: []age.Recipient{r}}, nil
+}
+
+// ParseIdentityFile returns a Crypter that decrypts files with the X25519
+// identities in the file at filename, as with "age --decrypt -i filename",
+// and encrypts files to the recipients of those identities. Further
+// recipients can be added to the Crypter's Recipients.
+func ParseIdentityFile(filename string) (*Crypter, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ids, err := age.ParseIdentities(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("agecrypt: %s: %w", filename, err)
+	}
+	c := &Crypter{Identities: ids}
+	for _, id := range ids {
+		if x, ok := id.(*age.X25519Identity); ok {
+			c.Recipients = append(c.Recipients, x.Recipient())
+		}
+	}
+	return c, nil
+}
+
+// IsEncrypted reports whether data is an age file.
+func (c *Crypter) IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(binaryHeader)) || bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte(armorHeader))
+}
+
+// Decrypt returns the plaintext of the age file ciphertext.
+func (c *Crypter) Decrypt(ciphertext []byte) ([]byte, error) {
+	var src io.Reader = bytes.NewReader(ciphertext)
+	if !bytes.HasPrefix(ciphertext, []byte(binaryHeader)) {
+		src = armor.NewReader(src)
+	}
+	r, err := age.Decrypt(src, c.Identities...)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+// Encrypt returns plaintext encrypted to c's Recipients.
+func (c *Crypter) Encrypt(plaintext []byte) ([]byte, error) {
+	if len(c.Recipients) == 0 {
+		return nil, errors.New("agecrypt: no recipients to encrypt to")
+	}
+	var buf bytes.Buffer
+	var dst io.Writer = &buf
+	var aw io.WriteCloser
+	if c.Armor {
+		aw = armor.NewWriter(&buf)
+		dst = aw
+	}
+	w, err := age.Encrypt(dst, c.Recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if aw != nil {
+		if err := aw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
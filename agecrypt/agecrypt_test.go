@@ -0,0 +1,115 @@
+package agecrypt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+
+	"toolman.org/file/netrc"
+)
+
+func TestIdentityFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agecrypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "key.txt")
+	if err := ioutil.WriteFile(keyFile, []byte("# test key\n"+id.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := ParseIdentityFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Recipients = append(c.Recipients, other.Recipient())
+
+	testRoundTrip(t, c, filepath.Join(dir, ".netrc.age"), &Crypter{Identities: []age.Identity{other}})
+}
+
+func TestPassphrase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agecrypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := Passphrase("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Recipients[0].(*age.ScryptRecipient).SetWorkFactor(10) // keep the test fast
+	c.Armor = true
+	testRoundTrip(t, c, filepath.Join(dir, ".netrc.age"), nil)
+}
+
+// testRoundTrip writes a netrc encrypted with c to path, and checks that it
+// can be read back and saved again without its secrets reaching the disk.
+// If reader is not nil, it must also be able to read the saved file.
+func testRoundTrip(t *testing.T, c *Crypter, path string, reader *Crypter) {
+	t.Helper()
+
+	n, err := netrc.Parse(strings.NewReader("# work\nmachine example.com login me password first-secret\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.SetCrypter(c)
+	if err := n.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	checkEncrypted(t, c, path)
+
+	n, err = netrc.ParseFileWithOptions(path, netrc.ParseFileOptions{Crypter: c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := n.FindMachine("example.com")
+	if m == nil || m.Password != "first-secret" {
+		t.Fatalf("expected machine with password first-secret, got %+v", m)
+	}
+	m.UpdatePassword("second-secret")
+	if err := n.Save(); err != nil {
+		t.Fatal(err)
+	}
+	checkEncrypted(t, c, path)
+
+	if reader == nil {
+		reader = c
+	}
+	n, err = netrc.ParseFileWithOptions(path, netrc.ParseFileOptions{Crypter: reader})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, _ := n.MarshalText()
+	if want := "# work\nmachine example.com login me password second-secret\n"; string(text) != want {
+		t.Errorf("expected %q, got %q", want, text)
+	}
+}
+
+func checkEncrypted(t *testing.T, c *Crypter, path string) {
+	t.Helper()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.IsEncrypted(b) || bytes.Contains(b, []byte("secret")) || bytes.Contains(b, []byte("example.com")) {
+		t.Errorf("%s is not encrypted:\n%s", path, b)
+	}
+	if c.Armor != bytes.HasPrefix(b, []byte(armorHeader)) {
+		t.Errorf("%s: expected armor %v", path, c.Armor)
+	}
+}
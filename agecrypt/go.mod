@@ -0,0 +1,23 @@
+module toolman.org/file/netrc/agecrypt
+
+go 1.21
+
+require (
+	filippo.io/age v1.2.1
+	toolman.org/file/netrc v0.1.0
+)
+
+require (
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+)
+
+// To work on agecrypt and the netrc package together, use a go.work in the
+// parent directory rather than a replace directive here:
+//
+//	go work init . ./agecrypt
+//	go work edit -replace toolman.org/file/netrc@v0.1.0=.
+//
+// The second command is only needed while the required version of netrc is
+// not yet tagged. go.work is not committed, so builds of agecrypt always use
+// a released version of netrc.
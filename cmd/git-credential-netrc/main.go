@@ -0,0 +1,183 @@
+// Command git-credential-netrc is a git credential helper that keeps
+// credentials in a netrc file.
+//
+// To use it, put it on your PATH and configure git with:
+//
+//	git config --global credential.helper netrc
+//
+// Credentials are read from and written to the file named by the -f flag,
+// or the file found by netrc.DefaultPath if -f is not given. Changes are
+// written atomically and leave the rest of the file, including comments and
+// formatting, untouched. The ``default'' entry is never used.
+//
+// An entry that gets its password from a command with passwordeval is
+// never changed or erased, and only its login is given to git: the command
+// is not run, and is never passed off as a password.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"toolman.org/file/netrc"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "git-credential-netrc: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("git-credential-netrc", flag.ContinueOnError)
+	file := fs.String("f", "", "netrc `file` to use instead of the default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: git-credential-netrc [-f file] get|store|erase")
+	}
+
+	path := *file
+	if path == "" {
+		var err error
+		if path, err = netrc.DefaultPath(); err != nil {
+			return err
+		}
+	}
+
+	attrs, err := readAttrs(stdin)
+	if err != nil {
+		return err
+	}
+	if attrs["host"] == "" {
+		// nothing we can do without a host
+		return nil
+	}
+
+	switch op := fs.Arg(0); op {
+	case "get":
+		return get(path, attrs, stdout)
+	case "store":
+		return store(path, attrs)
+	case "erase":
+		return erase(path, attrs)
+	default:
+		// git may add operations in the future; helpers must ignore them
+		return nil
+	}
+}
+
+// readAttrs reads the key=value lines of a credential description, up to a
+// blank line or EOF.
+func readAttrs(r io.Reader) (map[string]string, error) {
+	attrs := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			break
+		}
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid input line %q", line)
+		}
+		attrs[line[:i]] = line[i+1:]
+	}
+	return attrs, scanner.Err()
+}
+
+func get(path string, attrs map[string]string, w io.Writer) error {
+	n, err := netrc.ParseFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	m := findMachine(n, attrs["host"], attrs["username"])
+	if m == nil {
+		return nil
+	}
+	if m.Login != "" {
+		fmt.Fprintf(w, "username=%s\n", m.Login)
+	}
+	if m.Password != "" {
+		fmt.Fprintf(w, "password=%s\n", m.Password)
+	}
+	return nil
+}
+
+func store(path string, attrs map[string]string) error {
+	user, pass := attrs["username"], attrs["password"]
+	if user == "" || pass == "" {
+		return nil
+	}
+
+	n, err := netrc.ParseFile(path)
+	switch {
+	case os.IsNotExist(err):
+		n = &netrc.Netrc{}
+	case err != nil:
+		return err
+	}
+
+	m := findMachine(n, attrs["host"], user)
+	switch {
+	case m == nil:
+		n.NewMachine(hostname(attrs["host"]), user, pass, "")
+	case m.Password == pass, m.PasswordEval != "":
+		return nil
+	default:
+		m.UpdatePassword(pass)
+	}
+	return n.WriteFile(path)
+}
+
+func erase(path string, attrs map[string]string) error {
+	n, err := netrc.ParseFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	m := findMachine(n, attrs["host"], attrs["username"])
+	if m == nil || m.PasswordEval != "" {
+		return nil
+	}
+	m.Remove()
+	return n.WriteFile(path)
+}
+
+// findMachine returns the first machine for host, which may include a
+// port, whose login is user, or the first machine for host if user is
+// empty. Machines named with the port are preferred over those named with
+// just the host name. The ``default'' machine is ignored.
+func findMachine(n *netrc.Netrc, host, user string) *netrc.Machine {
+	for _, name := range []string{host, hostname(host)} {
+		for _, m := range n.FindMachines(name) {
+			if user == "" || m.Login == user {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+// hostname returns host without any port.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const initial = `# shared credentials
+machine github.com
+	login alice
+	password oldtoken
+
+machine git.example.com login dave passwordeval "pass show git"
+
+default login anonymous password guest
+`
+
+func helper(t *testing.T, path, op, input string) string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := run([]string{"-f", path, op}, strings.NewReader(input), &out); err != nil {
+		t.Fatalf("%s: %v", op, err)
+	}
+	return out.String()
+}
+
+func TestHelper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-credential-netrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ".netrc")
+	if err := ioutil.WriteFile(path, []byte(initial), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		op, input, want string
+	}{
+		{"get", "protocol=https\nhost=github.com\n\n", "username=alice\npassword=oldtoken\n"},
+		{"get", "protocol=https\nhost=github.com:443\n", "username=alice\npassword=oldtoken\n"},
+		{"get", "protocol=https\nhost=github.com\nusername=bob\n", ""},
+		{"get", "protocol=https\nhost=example.com\n", ""},
+		{"store", "protocol=https\nhost=github.com\nusername=alice\npassword=newtoken\n", ""},
+		{"get", "protocol=https\nhost=github.com\n", "username=alice\npassword=newtoken\n"},
+		// a second login for the same host gets its own entry
+		{"store", "protocol=https\nhost=github.com\nusername=bob\npassword=bobtoken\n", ""},
+		{"get", "protocol=https\nhost=github.com\nusername=bob\n", "username=bob\npassword=bobtoken\n"},
+		{"store", "protocol=https\nhost=github.com\nusername=bob\npassword=bobtoken2\n", ""},
+		{"get", "protocol=https\nhost=github.com\nusername=bob\n", "username=bob\npassword=bobtoken2\n"},
+		{"get", "protocol=https\nhost=github.com\nusername=alice\n", "username=alice\npassword=newtoken\n"},
+		{"erase", "protocol=https\nhost=github.com\nusername=bob\n", ""},
+		{"get", "protocol=https\nhost=github.com\nusername=bob\n", ""},
+		{"store", "protocol=https\nhost=gitlab.com:8443\nusername=carol\npassword=glpat\n", ""},
+		{"get", "protocol=https\nhost=gitlab.com:8443\n", "username=carol\npassword=glpat\n"},
+		{"erase", "protocol=https\nhost=github.com\nusername=bob\n", ""},
+		{"get", "protocol=https\nhost=github.com\n", "username=alice\npassword=newtoken\n"},
+		{"erase", "protocol=https\nhost=github.com\nusername=alice\n", ""},
+		{"get", "protocol=https\nhost=github.com\n", ""},
+		// an entry with a passwordeval command is never changed
+		{"get", "protocol=https\nhost=git.example.com\n", "username=dave\n"},
+		{"store", "protocol=https\nhost=git.example.com\nusername=dave\npassword=typed\n", ""},
+		{"erase", "protocol=https\nhost=git.example.com\nusername=dave\n", ""},
+		{"get", "protocol=https\nhost=git.example.com\n", "username=dave\n"},
+		{"unknown", "host=github.com\n", ""},
+	}
+	for _, test := range tests {
+		if got := helper(t, path, test.op, test.input); got != test.want {
+			t.Errorf("%s %q: expected %q, got %q", test.op, test.input, test.want, got)
+		}
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# shared credentials
+
+machine git.example.com login dave passwordeval "pass show git"
+machine gitlab.com
+	login carol
+	password glpat
+
+default login anonymous password guest
+`
+	if string(b) != want {
+		t.Errorf("expected file:\n%q\ngot:\n%q", want, string(b))
+	}
+
+	missing := filepath.Join(dir, "missing", ".netrc")
+	if got := helper(t, missing, "get", "host=github.com\n"); got != "" {
+		t.Errorf("expected no output for missing file, got %q", got)
+	}
+}
@@ -0,0 +1,439 @@
+// Command netrc queries and edits netrc files.
+//
+// Usage:
+//
+//	netrc [-file path] command [arguments]
+//
+// The commands are:
+//
+//	get [-json] [-show-password] [-no-default] machine
+//		print the entry that would be used for machine
+//	set [-login l] [-password p | -password-stdin] [-account a] machine
+//		update the entry for machine, adding it if necessary
+//	list [-json] [-show-password]
+//		print every entry
+//	rm machine
+//		remove the entry for machine
+//	fmt [-w]
+//		print the file in canonical form, or rewrite it with -w
+//	check
+//		report parse errors, and unsafe file permissions if the file
+//		holds passwords
+//	encrypt -key keyfile [-account] [-d]
+//		encrypt each password, and each account with -account, in place
+//		with the key in keyfile, or decrypt them with -d
+//
+// By default the file found by netrc.DefaultPath is used. Output is written
+// as shell variable assignments suitable for eval, or as JSON with -json.
+// Passwords, and the commands given with passwordeval, are omitted from
+// output unless -show-password is given. Files
+// are rewritten atomically, and set and rm leave comments and formatting
+// untouched.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"toolman.org/file/netrc"
+)
+
+// errSilent causes a non-zero exit status without an additional message.
+var errSilent = errors.New("")
+
+type cli struct {
+	path   string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if err != errSilent {
+			fmt.Fprintf(os.Stderr, "netrc: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("netrc", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("file", "", "netrc `path` to use instead of the default")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: netrc [-file path] get|set|list|rm|fmt|check|encrypt [arguments]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return errSilent
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errSilent
+	}
+
+	c := &cli{path: *file, stdin: stdin, stdout: stdout, stderr: stderr}
+	if c.path == "" {
+		var err error
+		if c.path, err = netrc.DefaultPath(); err != nil {
+			return err
+		}
+	}
+
+	cmds := map[string]func([]string) error{
+		"get":     c.get,
+		"set":     c.set,
+		"list":    c.list,
+		"rm":      c.rm,
+		"fmt":     c.fmt,
+		"check":   c.check,
+		"encrypt": c.encrypt,
+	}
+	cmd, ok := cmds[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown command %q", fs.Arg(0))
+	}
+	return cmd(fs.Args()[1:])
+}
+
+func (c *cli) flags(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "usage: netrc %s %s\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func parseArgs(fs *flag.FlagSet, args []string, nargs int) error {
+	if err := fs.Parse(args); err != nil {
+		return errSilent
+	}
+	if fs.NArg() != nargs {
+		fs.Usage()
+		return errSilent
+	}
+	return nil
+}
+
+func (c *cli) get(args []string) error {
+	fs := c.flags("get", "[-json] [-show-password] [-no-default] machine")
+	asJSON := fs.Bool("json", false, "write output as JSON")
+	showPassword := fs.Bool("show-password", false, "include the password in the output")
+	noDefault := fs.Bool("no-default", false, "do not fall back to the default entry")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+
+	n, err := netrc.ParseFile(c.path)
+	if err != nil {
+		return err
+	}
+	m, _ := n.FindMachineWithOptions(fs.Arg(0), netrc.LookupOptions{DisableDefault: *noDefault})
+	if m == nil {
+		return fmt.Errorf("no entry for machine %q", fs.Arg(0))
+	}
+
+	e := newEntry(m, *showPassword)
+	if *asJSON {
+		return c.writeJSON(e)
+	}
+	e.writeShell(c.stdout)
+	return nil
+}
+
+func (c *cli) set(args []string) error {
+	fs := c.flags("set", "[-login l] [-password p | -password-stdin] [-account a] machine")
+	var login, password, account optString
+	fs.Var(&login, "login", "set the login to `value`")
+	fs.Var(&password, "password", "set the password to `value`")
+	fs.Var(&account, "account", "set the account to `value`")
+	passwordStdin := fs.Bool("password-stdin", false, "read the password from the first line of standard input")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	name := fs.Arg(0)
+
+	if *passwordStdin {
+		if password.set {
+			return errors.New("-password and -password-stdin are mutually exclusive")
+		}
+		line, err := bufio.NewReader(c.stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		password.Set(strings.TrimRight(line, "\r\n"))
+	}
+
+	n, err := c.parseOrNew()
+	if err != nil {
+		return err
+	}
+	m := n.FindMachine(name)
+	if m == nil || m.IsDefault() {
+		n.NewMachine(name, login.value, password.value, account.value)
+	} else {
+		if login.set {
+			m.UpdateLogin(login.value)
+		}
+		if password.set {
+			m.UpdatePassword(password.value)
+		}
+		if account.set {
+			m.UpdateAccount(account.value)
+		}
+	}
+	return n.WriteFile(c.path)
+}
+
+func (c *cli) list(args []string) error {
+	fs := c.flags("list", "[-json] [-show-password]")
+	asJSON := fs.Bool("json", false, "write output as JSON")
+	showPassword := fs.Bool("show-password", false, "include passwords in the output")
+	if err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	n, err := netrc.ParseFile(c.path)
+	if err != nil {
+		return err
+	}
+	entries := []*entry{}
+	n.Visit(func(m *netrc.Machine) error {
+		entries = append(entries, newEntry(m, *showPassword))
+		return nil
+	})
+
+	if *asJSON {
+		return c.writeJSON(entries)
+	}
+	for i, e := range entries {
+		if i > 0 {
+			fmt.Fprintln(c.stdout)
+		}
+		e.writeShell(c.stdout)
+	}
+	return nil
+}
+
+func (c *cli) rm(args []string) error {
+	fs := c.flags("rm", "machine")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+
+	n, err := netrc.ParseFile(c.path)
+	if err != nil {
+		return err
+	}
+	if m := n.FindMachine(fs.Arg(0)); m == nil || m.IsDefault() {
+		return fmt.Errorf("no entry for machine %q", fs.Arg(0))
+	}
+	n.RemoveMachine(fs.Arg(0))
+	return n.WriteFile(c.path)
+}
+
+func (c *cli) fmt(args []string) error {
+	fs := c.flags("fmt", "[-w]")
+	write := fs.Bool("w", false, "rewrite the file instead of printing it")
+	if err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	n, err := netrc.ParseFile(c.path)
+	if err != nil {
+		return err
+	}
+	text := canonical(n)
+	if !*write {
+		_, err := c.stdout.Write(text)
+		return err
+	}
+	formatted, err := netrc.Parse(bytes.NewReader(text))
+	if err != nil {
+		return err
+	}
+	return formatted.WriteFile(c.path)
+}
+
+func (c *cli) check(args []string) error {
+	fs := c.flags("check", "")
+	if err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	// permissions only matter if the file holds passwords, as with ftp(1)
+	_, err := netrc.ParseFileWithOptions(c.path, netrc.ParseFileOptions{StrictPermissions: true})
+	var perr *netrc.PermissionError
+	switch {
+	case errors.As(err, &perr):
+		fmt.Fprintln(c.stderr, err)
+		return errSilent
+	case err != nil:
+		fmt.Fprintf(c.stderr, "%s: %v\n", c.path, err)
+		return errSilent
+	}
+	return nil
+}
+
+func (c *cli) encrypt(args []string) error {
+	fs := c.flags("encrypt", "-key keyfile [-account] [-d]")
+	keyFile := fs.String("key", "", "read the key from `keyfile`")
+	accounts := fs.Bool("account", false, "encrypt accounts as well as passwords")
+	decrypt := fs.Bool("d", false, "decrypt values instead of encrypting them")
+	if err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	if *keyFile == "" {
+		fs.Usage()
+		return errSilent
+	}
+
+	key, err := netrc.ReadKeyFile(*keyFile)
+	if err != nil {
+		return err
+	}
+	n, err := netrc.ParseFile(c.path)
+	if err != nil {
+		return err
+	}
+	if *decrypt {
+		_, err = n.DecryptValues(key)
+	} else {
+		_, err = n.EncryptValues(key, *accounts)
+	}
+	if err != nil {
+		return err
+	}
+	return n.WriteFile(c.path)
+}
+
+// parseOrNew parses the netrc file, or returns an empty Netrc if it doesn't
+// exist yet.
+func (c *cli) parseOrNew() (*netrc.Netrc, error) {
+	n, err := netrc.ParseFile(c.path)
+	if os.IsNotExist(err) {
+		return &netrc.Netrc{}, nil
+	}
+	return n, err
+}
+
+func (c *cli) writeJSON(v interface{}) error {
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// canonical returns the text of n with every entry in the same layout and
+// comments removed. Every field is kept under its own keyword. Macros are
+// written after the machines, sorted by name.
+func canonical(n *netrc.Netrc) []byte {
+	var b strings.Builder
+	n.Visit(func(m *netrc.Machine) error {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		if m.IsDefault() {
+			b.WriteString("default\n")
+		} else {
+			fmt.Fprintf(&b, "machine %s\n", netrc.QuoteValue(m.Name))
+		}
+		for _, f := range [][2]string{
+			{"login", m.Login},
+			{"password", m.Password},
+			{"passwordeval", m.PasswordEval},
+			{"account", m.Account},
+			{"port", m.Port},
+		} {
+			if f[1] != "" {
+				fmt.Fprintf(&b, "\t%s %s\n", f[0], netrc.QuoteValue(f[1]))
+			}
+		}
+		return nil
+	})
+
+	macros := n.Macros()
+	names := make([]string, 0, len(macros))
+	for name := range macros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "macdef %s\n%s\n", name, macros[name])
+	}
+	return []byte(b.String())
+}
+
+type entry struct {
+	Machine  string `json:"machine,omitempty"`
+	Default  bool   `json:"default,omitempty"`
+	Login    string `json:"login,omitempty"`
+	Password string `json:"password,omitempty"`
+	Account  string `json:"account,omitempty"`
+
+	PasswordEval string `json:"passwordeval,omitempty"`
+}
+
+func newEntry(m *netrc.Machine, showPassword bool) *entry {
+	e := &entry{
+		Machine: m.Name,
+		Default: m.IsDefault(),
+		Login:   m.Login,
+		Account: m.Account,
+	}
+	if showPassword {
+		e.Password, e.PasswordEval = m.Password, m.PasswordEval
+	}
+	return e
+}
+
+// writeShell writes e as shell variable assignments.
+func (e *entry) writeShell(w io.Writer) {
+	vars := [][2]string{
+		{"machine", e.Machine},
+		{"login", e.Login},
+		{"password", e.Password},
+		{"passwordeval", e.PasswordEval},
+		{"account", e.Account},
+	}
+	if e.Default {
+		vars[0] = [2]string{"default", "1"}
+	}
+	for _, v := range vars {
+		if v[1] != "" {
+			fmt.Fprintf(w, "%s=%s\n", v[0], shellQuote(v[1]))
+		}
+	}
+}
+
+// shellQuote quotes s for use as a single word in a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// optString is a flag.Value that records whether it was set, so that an
+// explicitly empty value can be told apart from an absent one.
+type optString struct {
+	value string
+	set   bool
+}
+
+func (o *optString) String() string { return o.value }
+
+func (o *optString) Set(s string) error {
+	o.value, o.set = s, true
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const initial = `# team credentials
+machine api.example.com login alice password "s3cret pass" # rotated monthly
+
+default
+	login anonymous
+	password guest
+`
+
+func netrcCmd(t *testing.T, path, stdin string, args ...string) (string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	err := run(append([]string{"-file", path}, args...), strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String() + stderr.String(), err
+}
+
+func TestCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ".netrc")
+	if err := ioutil.WriteFile(path, []byte(initial), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		stdin string
+		args  []string
+		want  string
+	}{
+		{"", []string{"get", "api.example.com"}, "machine='api.example.com'\nlogin='alice'\n"},
+		{"", []string{"get", "-show-password", "api.example.com"}, "machine='api.example.com'\nlogin='alice'\npassword='s3cret pass'\n"},
+		{"", []string{"get", "-json", "other.example.com"}, "{\n  \"default\": true,\n  \"login\": \"anonymous\"\n}\n"},
+		{"it's\n", []string{"set", "-password-stdin", "api.example.com"}, ""},
+		{"", []string{"set", "-login", "bob", "-password", "pw", "new.example.com"}, ""},
+		{"", []string{"get", "-show-password", "api.example.com"}, "machine='api.example.com'\nlogin='alice'\npassword='it'\\''s'\n"},
+		{"", []string{"list"}, "machine='api.example.com'\nlogin='alice'\n\nmachine='new.example.com'\nlogin='bob'\n\ndefault='1'\nlogin='anonymous'\n"},
+		{"", []string{"check"}, ""},
+	}
+	for _, test := range tests {
+		got, err := netrcCmd(t, path, test.stdin, test.args...)
+		if err != nil {
+			t.Errorf("%v: %v", test.args, err)
+		}
+		if got != test.want {
+			t.Errorf("%v: expected %q, got %q", test.args, test.want, got)
+		}
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# team credentials
+machine api.example.com login alice password it's # rotated monthly
+machine new.example.com
+	login bob
+	password pw
+
+default
+	login anonymous
+	password guest
+`
+	if string(b) != want {
+		t.Errorf("expected file:\n%q\ngot:\n%q", want, string(b))
+	}
+
+	if _, err := netrcCmd(t, path, "", "rm", "new.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := netrcCmd(t, path, "", "rm", "new.example.com"); err == nil {
+		t.Error("expected an error removing a missing machine, got none")
+	}
+
+	if _, err := netrcCmd(t, path, "", "fmt", "-w"); err != nil {
+		t.Fatal(err)
+	}
+	b, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `machine api.example.com
+	login alice
+	password it's
+
+default
+	login anonymous
+	password guest
+`
+	if string(b) != want {
+		t.Errorf("expected formatted file:\n%q\ngot:\n%q", want, string(b))
+	}
+
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := netrcCmd(t, path, "", "check"); err == nil || out == "" {
+		t.Errorf("expected check to fail for mode 0644, got %q, %v", out, err)
+	}
+
+	// permissions don't matter for a file without passwords
+	if err := ioutil.WriteFile(path, []byte("machine example.com login alice\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := netrcCmd(t, path, "", "check"); err != nil {
+		t.Errorf("expected check to pass without passwords, got %q, %v", out, err)
+	}
+}
+
+func TestPasswordEval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ".netrc")
+	if err := ioutil.WriteFile(path, []byte("machine smtp.example.com login me passwordeval \"pass show smtp\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"get", "smtp.example.com"}, "machine='smtp.example.com'\nlogin='me'\n"},
+		{[]string{"get", "-show-password", "smtp.example.com"}, "machine='smtp.example.com'\nlogin='me'\npasswordeval='pass show smtp'\n"},
+		{[]string{"get", "-json", "-show-password", "smtp.example.com"}, "{\n  \"machine\": \"smtp.example.com\",\n  \"login\": \"me\",\n  \"passwordeval\": \"pass show smtp\"\n}\n"},
+		{[]string{"fmt"}, "machine smtp.example.com\n\tlogin me\n\tpasswordeval \"pass show smtp\"\n"},
+	}
+	for _, test := range tests {
+		got, err := netrcCmd(t, path, "", test.args...)
+		if err != nil {
+			t.Errorf("%v: %v", test.args, err)
+		}
+		if got != test.want {
+			t.Errorf("%v: expected %q, got %q", test.args, test.want, got)
+		}
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ".netrc")
+	if err := ioutil.WriteFile(path, []byte(initial), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, []byte("MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := netrcCmd(t, path, "", "encrypt", "-key", keyFile); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("s3cret")) || bytes.Count(b, []byte("password ENC[AES256_GCM,")) != 2 {
+		t.Errorf("expected encrypted passwords, got:\n%s", b)
+	}
+
+	if _, err := netrcCmd(t, path, "", "encrypt", "-d", "-key", keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != initial {
+		t.Errorf("expected decrypted file:\n%q\ngot:\n%q", initial, string(b))
+	}
+}
@@ -0,0 +1,42 @@
+package netrc
+
+// A Crypter reads and writes netrc files kept in an encrypted container,
+// such as an age file. See ParseFileOptions for how one is used to read a
+// file. A Netrc read with a Crypter, or given one with SetCrypter, encrypts
+// its text with it whenever it is written by Save or WriteFile, so that the
+// plaintext never reaches the disk.
+//
+// The toolman.org/file/netrc/gpgcrypt package provides a Crypter for files
+// encrypted with GnuPG, such as ~/.authinfo.gpg. The
+// toolman.org/file/netrc/agecrypt package provides one for age; it is a
+// module of its own so that this module does not depend on age.
+type Crypter interface {
+	// IsEncrypted reports whether data, the contents of a file, is in
+	// the Crypter's encrypted format.
+	IsEncrypted(data []byte) bool
+
+	// Decrypt returns the plaintext of ciphertext.
+	Decrypt(ciphertext []byte) ([]byte, error)
+
+	// Encrypt returns plaintext encrypted in the Crypter's format. It
+	// should encrypt to the same recipients as the file it decrypted, so
+	// that everyone who could read the file before it was saved can
+	// still read it.
+	Encrypt(plaintext []byte) ([]byte, error)
+}
+
+// Crypter returns the Crypter that n is encrypted with when written, or nil
+// if n is written as plain text.
+func (n *Netrc) Crypter() Crypter {
+	n.updateLock.RLock()
+	defer n.updateLock.RUnlock()
+	return n.crypter
+}
+
+// SetCrypter sets the Crypter used to encrypt n when it is written. A nil c
+// causes n to be written as plain text.
+func (n *Netrc) SetCrypter(c Crypter) {
+	n.updateLock.Lock()
+	defer n.updateLock.Unlock()
+	n.crypter = c
+}
@@ -0,0 +1,312 @@
+package netrc
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Changes describes the differences between two Netrc values, as found by
+// Diff. Passwords and accounts never appear in a Changes; they are replaced
+// by a fixed mask, so only the fact that one was set or changed is visible.
+type Changes struct {
+	Added   []*Machine      // Machines only in b, in b's order
+	Removed []*Machine      // Machines only in a, in a's order
+	Changed []MachineChange // Machines in both a and b that differ
+	Macros  []MacroChange   // Macros that were added, removed or changed
+
+	atext, btext []byte
+}
+
+// MachineChange describes the differences between two versions of a
+// machine. Name is empty for the ``default'' machine.
+type MachineChange struct {
+	Name   string
+	Port   string
+	Fields []FieldChange
+}
+
+// FieldChange describes a change to a single field of a machine. Field is
+// the keyword for the field, such as "login". An empty Old or New value
+// means the field was added or removed.
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// MacroChange describes a change to a macro definition. An empty Old or New
+// body means the macro was added or removed.
+type MacroChange struct {
+	Name string
+	Old  string
+	New  string
+}
+
+// Diff compares a and b and returns what changed going from a to b.
+//
+// Machines are matched by name and port. If a name appears more than once,
+// machines with the same login are matched first and any others are then
+// matched in the order they appear.
+func Diff(a, b *Netrc) *Changes {
+	amachines, amacros, atext := a.diffState()
+	bmachines, bmacros, btext := b.diffState()
+	c := &Changes{atext: atext, btext: btext}
+
+	matched := make(map[*Machine]*Machine) // a -> b
+	used := make(map[*Machine]bool)        // b machines matched so far
+	match := func(same func(am, bm *Machine) bool) {
+		for _, am := range amachines {
+			if matched[am] != nil {
+				continue
+			}
+			for _, bm := range bmachines {
+				if !used[bm] && same(am, bm) {
+					matched[am], used[bm] = bm, true
+					break
+				}
+			}
+		}
+	}
+	sameHost := func(am, bm *Machine) bool {
+		return am.Name == bm.Name && am.IsDefault() == bm.IsDefault() && am.Port == bm.Port
+	}
+	match(func(am, bm *Machine) bool { return sameHost(am, bm) && am.Login == bm.Login })
+	match(sameHost)
+
+	for _, am := range amachines {
+		bm := matched[am]
+		if bm == nil {
+			c.Removed = append(c.Removed, maskedMachine(am))
+			continue
+		}
+		if fields := diffFields(am, bm); len(fields) > 0 {
+			c.Changed = append(c.Changed, MachineChange{Name: am.Name, Port: am.Port, Fields: fields})
+		}
+	}
+	for _, bm := range bmachines {
+		if !used[bm] {
+			c.Added = append(c.Added, maskedMachine(bm))
+		}
+	}
+
+	var names []string
+	for name := range amacros {
+		names = append(names, name)
+	}
+	for name := range bmacros {
+		if _, ok := amacros[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if amacros[name] != bmacros[name] {
+			c.Macros = append(c.Macros, MacroChange{Name: name, Old: amacros[name], New: bmacros[name]})
+		}
+	}
+	return c
+}
+
+// Empty reports whether c holds no changes.
+func (c *Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0 && len(c.Macros) == 0
+}
+
+// Unified returns a unified diff of the text of the two Netrc values that
+// were compared, with every password and account replaced by a mask. The
+// names aName and bName are used to label the two sides. An empty string is
+// returned if the texts are the same.
+func (c *Changes) Unified(aName, bName string) string {
+	return unifiedDiff(aName, bName, c.atext, c.btext)
+}
+
+// diffState returns copies of n's machines and macros, along with its text
+// with passwords masked.
+func (n *Netrc) diffState() ([]*Machine, Macros, []byte) {
+	if n == nil {
+		return nil, nil, nil
+	}
+	n.updateLock.RLock()
+	defer n.updateLock.RUnlock()
+
+	machines := make([]*Machine, len(n.machines))
+	for i, m := range n.machines {
+		c := *m
+		machines[i] = &c
+	}
+	macros := make(Macros, len(n.macros))
+	for k, v := range n.macros {
+		macros[k] = v
+	}
+	return machines, macros, n.marshal(tkPassword, tkPasswordEval, tkAccount)
+}
+
+func maskedMachine(m *Machine) *Machine {
+	return &Machine{
+		Name:         m.Name,
+		Login:        m.Login,
+		Password:     maskValue(m.Password),
+		Account:      maskValue(m.Account),
+		Port:         m.Port,
+		PasswordEval: maskValue(m.PasswordEval),
+	}
+}
+
+func maskValue(v string) string {
+	if v == "" {
+		return ""
+	}
+	return mask
+}
+
+func diffFields(a, b *Machine) []FieldChange {
+	var fields []FieldChange
+	for _, f := range []struct {
+		name     string
+		old, new string
+		secret   bool
+	}{
+		{"login", a.Login, b.Login, false},
+		{"password", a.Password, b.Password, true},
+		{"passwordeval", a.PasswordEval, b.PasswordEval, true},
+		{"account", a.Account, b.Account, true},
+		{"port", a.Port, b.Port, false},
+	} {
+		if f.old == f.new {
+			continue
+		}
+		if f.secret {
+			f.old, f.new = maskValue(f.old), maskValue(f.new)
+		}
+		fields = append(fields, FieldChange{Field: f.name, Old: f.old, New: f.new})
+	}
+	return fields
+}
+
+// unifiedDiff returns a unified diff, with three lines of context, that
+// turns a into b.
+func unifiedDiff(aName, bName string, a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	alines, blines := splitLines(a), splitLines(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// alines[i:] and blines[j:].
+	lcs := make([][]int, len(alines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(blines)+1)
+	}
+	for i := len(alines) - 1; i >= 0; i-- {
+		for j := len(blines) - 1; j >= 0; j-- {
+			if alines[i] == blines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	type edit struct {
+		op   byte // ' ', '-' or '+'
+		line string
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(alines) || j < len(blines) {
+		switch {
+		case i < len(alines) && j < len(blines) && alines[i] == blines[j]:
+			edits = append(edits, edit{' ', alines[i]})
+			i++
+			j++
+		case j == len(blines) || i < len(alines) && lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, edit{'-', alines[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', blines[j]})
+			j++
+		}
+	}
+
+	const context = 3
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+	aline, bline := 1, 1 // line numbers of edits[k]
+	for k := 0; k < len(edits); {
+		if edits[k].op == ' ' {
+			aline++
+			bline++
+			k++
+			continue
+		}
+
+		// extend the hunk until there are more than 2*context unchanged
+		// lines before the next change
+		start := k - context
+		if start < 0 {
+			start = 0
+		}
+		end, run := k, 0
+		for ; end < len(edits) && run <= 2*context; end++ {
+			if edits[end].op == ' ' {
+				run++
+			} else {
+				run = 0
+			}
+		}
+		if run > context {
+			end -= run - context
+		}
+
+		astart, bstart := aline-(k-start), bline-(k-start)
+		var acount, bcount int
+		for _, e := range edits[start:end] {
+			if e.op != '+' {
+				acount++
+			}
+			if e.op != '-' {
+				bcount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(astart, acount), hunkRange(bstart, bcount))
+		for _, e := range edits[start:end] {
+			out.WriteByte(e.op)
+			out.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		aline, bline = astart+acount, bstart+bcount
+		k = end
+	}
+	return out.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines splits text into lines, each including its newline.
+func splitLines(text []byte) []string {
+	var lines []string
+	for len(text) > 0 {
+		i := bytes.IndexByte(text, '\n') + 1
+		if i == 0 {
+			i = len(text)
+		}
+		lines = append(lines, string(text[:i]))
+		text = text[i:]
+	}
+	return lines
+}
@@ -0,0 +1,194 @@
+package netrc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Encrypted values are written in the same form as sops uses, as in
+//
+//	machine example.com login me password ENC[AES256_GCM,data:...,iv:...,tag:...,type:str]
+//
+// so that a netrc file can be kept in version control with only its secrets
+// hidden. The keyword of the field ("password" or "account"), the machine
+// name and the login are used as additional authenticated data, so a value
+// cannot be moved to a different field or machine unnoticed. Renaming a
+// machine or changing its login therefore requires decrypting its values
+// first.
+const (
+	encPrefix = "ENC[AES256_GCM,"
+	encSuffix = "]"
+)
+
+// KeySize is the size in bytes of the keys used by EncryptValues and
+// DecryptValues.
+const KeySize = 32
+
+// ReadKeyFile returns the key held in the file at filename for use with
+// EncryptValues and DecryptValues. The file must hold KeySize bytes encoded
+// in standard base64, such as the output of
+//
+//	head -c 32 /dev/urandom | base64
+func ReadKeyFile(filename string) ([]byte, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(key) != KeySize {
+		return nil, fmt.Errorf("netrc: %s does not hold a base64 encoded %d byte key", filename, KeySize)
+	}
+	return key, nil
+}
+
+// IsEncryptedValue reports whether value was encrypted by EncryptValues.
+func IsEncryptedValue(value string) bool {
+	return strings.HasPrefix(value, encPrefix) && strings.HasSuffix(value, encSuffix)
+}
+
+// EncryptValues encrypts the password of each machine in n with key, and the
+// account as well if accounts is true, and returns the number of values
+// encrypted. Values that are already encrypted are left alone. Only the
+// encrypted values change; everything else in n's text, including the
+// layout around those values, is kept exactly as it was.
+func (n *Netrc) EncryptValues(key []byte, accounts bool) (int, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return 0, err
+	}
+	kinds := []tkType{tkPassword}
+	if accounts {
+		kinds = append(kinds, tkAccount)
+	}
+	return n.transformValues(kinds, func(m *Machine, kind tkType, value string) (string, bool, error) {
+		if IsEncryptedValue(value) {
+			return "", false, nil
+		}
+		enc, err := encryptValue(aead, valueAAD(m, kind), value)
+		return enc, true, err
+	})
+}
+
+// DecryptValues decrypts each password and account in n that was encrypted
+// by EncryptValues, and returns the number of values decrypted. If any value
+// cannot be decrypted with key, an error naming its machine is returned and
+// n is not changed.
+func (n *Netrc) DecryptValues(key []byte) (int, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return 0, err
+	}
+	return n.transformValues([]tkType{tkPassword, tkAccount}, func(m *Machine, kind tkType, value string) (string, bool, error) {
+		if !IsEncryptedValue(value) {
+			return "", false, nil
+		}
+		dec, err := decryptValue(aead, valueAAD(m, kind), value)
+		return dec, true, err
+	})
+}
+
+// transformValues applies fn to the value of each field of the given kinds
+// in each of n's machines, replacing the values for which fn returns true.
+// Either every replacement is made or, if fn returns an error, none are.
+func (n *Netrc) transformValues(kinds []tkType, fn func(m *Machine, kind tkType, value string) (string, bool, error)) (int, error) {
+	n.updateLock.Lock()
+	defer n.updateLock.Unlock()
+
+	type change struct {
+		field *string
+		t     *token
+		value string
+	}
+	var changes []change
+	for _, m := range n.machines {
+		for _, kind := range kinds {
+			field, tp := m.fieldRefs(kind)
+			if *tp == nil || *field == "" {
+				continue
+			}
+			value, ok, err := fn(m, kind, *field)
+			if err != nil {
+				return 0, fmt.Errorf("netrc: %s: %s: %w", describeMachine(m.Name), kindKeyword(kind), err)
+			}
+			if ok {
+				changes = append(changes, change{field, *tp, value})
+			}
+		}
+	}
+	for _, c := range changes {
+		*c.field = c.value
+		updateTokenValue(c.t, c.value)
+	}
+	return len(changes), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("netrc: key must be %d bytes, not %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// valueAAD returns the additional authenticated data for the value of m's
+// field of the given kind.
+func valueAAD(m *Machine, kind tkType) []byte {
+	return []byte(strings.Join([]string{kindKeyword(kind), m.Name, m.Login}, keysep))
+}
+
+func encryptValue(aead cipher.AEAD, aad []byte, value string) (string, error) {
+	iv := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nil, iv, []byte(value), aad)
+	data, tag := sealed[:len(value)], sealed[len(value):]
+	enc := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("%sdata:%s,iv:%s,tag:%s,type:str%s", encPrefix, enc(data), enc(iv), enc(tag), encSuffix), nil
+}
+
+func decryptValue(aead cipher.AEAD, aad []byte, value string) (string, error) {
+	parts := make(map[string][]byte)
+	for _, p := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(value, encPrefix), encSuffix), ",") {
+		i := strings.IndexByte(p, ':')
+		if i < 0 {
+			return "", errors.New("malformed encrypted value")
+		}
+		k, v := p[:i], p[i+1:]
+		if k == "type" {
+			if v != "str" {
+				return "", fmt.Errorf("unsupported encrypted value type %q", v)
+			}
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return "", fmt.Errorf("malformed encrypted value: %s: %w", k, err)
+		}
+		parts[k] = b
+	}
+	if len(parts["iv"]) != aead.NonceSize() || len(parts["tag"]) != aead.Overhead() {
+		return "", errors.New("malformed encrypted value")
+	}
+	plain, err := aead.Open(nil, parts["iv"], append(parts["data"], parts["tag"]...), aad)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func kindKeyword(kind tkType) string {
+	if kind == tkAccount {
+		return "account"
+	}
+	return "password"
+}
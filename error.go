@@ -1,20 +1,147 @@
 package netrc
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// These errors identify the kinds of problem that can be found in a netrc
+// file. Use errors.Is to test for them, as in
+//
+//	if errors.Is(err, netrc.ErrMultipleDefault) { ... }
+var (
+	ErrUnknownKeyword      = errors.New("keyword expected")
+	ErrMultipleDefault     = errors.New("multiple default token")
+	ErrBadDefaultOrder     = errors.New("default token must appear after all machine tokens")
+	ErrDuplicateField      = errors.New("duplicate field")
+	ErrDuplicateMachine    = errors.New("duplicate machine")
+	ErrFieldOutsideMachine = errors.New("field outside of machine definition")
+	ErrBadQuote            = errors.New("malformed quoted string")
+	ErrInsecurePermissions = errors.New("insecure netrc file permissions")
+)
 
 // Error represents a netrc file parse error.
 type Error struct {
 	LineNum int    // Line number
+	Column  int    // Column number, in bytes, starting at 1
+	Offset  int    // Byte offset from the start of the input
+	Token   string // Text of the offending token
 	Msg     string // Error message
+	Err     error  // Underlying error, such as ErrUnknownKeyword
 }
 
 // Error returns a string representation of error e.
 func (e *Error) Error() string {
+	if e.Column > 0 {
+		return fmt.Sprintf("line %d, column %d: %s", e.LineNum, e.Column, e.Msg)
+	}
 	return fmt.Sprintf("line %d: %s", e.LineNum, e.Msg)
 }
 
+// Unwrap returns the underlying error, if any.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether e is of the kind identified by target, one of the
+// sentinel errors defined by this package.
+func (e *Error) Is(target error) bool {
+	return e.Err != nil && errors.Is(e.Err, target)
+}
+
+// BadDefaultOrder reports whether e is an ErrBadDefaultOrder error.
 func (e *Error) BadDefaultOrder() bool {
-	return e.Msg == errBadDefaultOrder
+	return errors.Is(e, ErrBadDefaultOrder)
+}
+
+// ErrorList is a list of parse errors, in the order they were found. It is
+// returned by a lenient parse; see ParseOptions.
+type ErrorList []*Error
+
+// Error returns a string representation of the errors in l.
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	case 2:
+		return fmt.Sprintf("%s (and 1 more error)", l[0])
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Is reports whether any error in l matches target.
+func (l ErrorList) Is(target error) bool {
+	for _, e := range l {
+		if errors.Is(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error in l that matches target, as with errors.As.
+func (l ErrorList) As(target interface{}) bool {
+	for _, e := range l {
+		if errors.As(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// PermissionError reports a netrc file that is not adequately protected.
+type PermissionError struct {
+	Path string      // Path of the file
+	Mode os.FileMode // Permission bits of the file
+	Msg  string      // Error message
 }
 
-const errBadDefaultOrder = "default token must appear after all machine tokens"
+// Error returns a string representation of error e.
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Msg)
+}
+
+// Is reports whether target is ErrInsecurePermissions.
+func (e *PermissionError) Is(target error) bool {
+	return target == ErrInsecurePermissions
+}
+
+// SecretError reports a password that could not be resolved by a
+// SecretResolver.
+type SecretError struct {
+	Machine string // Name of the machine, empty for the ``default'' machine
+	Path    string // Path of the file the machine was read from, if known
+	Line    int    // Line on which the machine's definition began, if known
+	Err     error  // Error returned by the SecretResolver
+}
+
+// Error returns a string representation of error e.
+func (e *SecretError) Error() string {
+	var where string
+	switch {
+	case e.Path != "" && e.Line > 0:
+		where = fmt.Sprintf("%s:%d: ", e.Path, e.Line)
+	case e.Path != "":
+		where = e.Path + ": "
+	case e.Line > 0:
+		where = fmt.Sprintf("line %d: ", e.Line)
+	}
+	return fmt.Sprintf("%s%s: resolving password: %v", where, describeMachine(e.Machine), e.Err)
+}
+
+// describeMachine returns a description of the machine named name for use
+// in error messages.
+func describeMachine(name string) string {
+	if name == "" {
+		return "default machine"
+	}
+	return "machine " + name
+}
+
+// Unwrap returns the error returned by the SecretResolver.
+func (e *SecretError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,115 @@
+package netrc
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Path returns the name of the file n was loaded from by ParseFile, or the
+// last file it was written to by WriteFile. It returns an empty string if n
+// is not associated with a file.
+func (n *Netrc) Path() string {
+	n.updateLock.RLock()
+	defer n.updateLock.RUnlock()
+	return n.path
+}
+
+// Save writes n back to the file returned by Path, as with WriteFile.
+func (n *Netrc) Save() error {
+	path := n.Path()
+	if path == "" {
+		return errors.New("netrc: no file to save to")
+	}
+	return n.WriteFile(path)
+}
+
+// WriteFile atomically replaces the file at filename with the text
+// representation of n. The new content is written to a temporary file in the
+// same directory, synced to disk and then renamed into place, so readers see
+// either the old file or the new one and never a partially written file.
+//
+// If filename is a symbolic link, the file it points to is replaced and the
+// link is left in place. The mode and, where supported, the owner of an
+// existing file are carried over to the new file; a new file is created with
+// mode 0600.
+//
+// If n has a Crypter, the text is encrypted before it is written, and only
+// the encrypted text is ever written to disk.
+func (n *Netrc) WriteFile(filename string) error {
+	n.updateLock.RLock()
+	text, crypter := n.marshal(), n.crypter
+	n.updateLock.RUnlock()
+	if crypter != nil {
+		var err error
+		if text, err = crypter.Encrypt(text); err != nil {
+			return fmt.Errorf("netrc: encrypting %s: %w", filename, err)
+		}
+	}
+
+	target, err := filepath.EvalSymlinks(filename)
+	switch {
+	case os.IsNotExist(err):
+		target = filename
+	case err != nil:
+		return err
+	}
+
+	if err := writeFileAtomic(target, text); err != nil {
+		return err
+	}
+	n.updateLock.Lock()
+	n.path = filename
+	n.updateLock.Unlock()
+	return nil
+}
+
+func writeFileAtomic(filename string, data []byte) (err error) {
+	mode := os.FileMode(0600)
+	fi, err := os.Stat(filename)
+	switch {
+	case err == nil:
+		mode = fi.Mode().Perm()
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := ioutil.TempFile(dir, "."+base+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = tmp.Chmod(mode); err != nil {
+		return err
+	}
+	if fi != nil {
+		if err = chownLike(tmp, fi); err != nil {
+			return err
+		}
+	}
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), filename); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
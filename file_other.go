@@ -0,0 +1,18 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package netrc
+
+import "os"
+
+func chownLike(f *os.File, fi os.FileInfo) error {
+	return nil
+}
+
+func syncDir(dir string) error {
+	return nil
+}
+
+func checkFileInfo(path string, fi os.FileInfo) error {
+	return nil
+}
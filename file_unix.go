@@ -0,0 +1,47 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package netrc
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// chownLike gives f the same owner and group as the file described by fi.
+// Changing to the same owner is always permitted, so this only fails if
+// another user's file is being replaced by someone other than root.
+func chownLike(f *os.File, fi os.FileInfo) error {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if int(st.Uid) == os.Geteuid() && int(st.Gid) == os.Getegid() {
+		return nil
+	}
+	return f.Chown(int(st.Uid), int(st.Gid))
+}
+
+// syncDir flushes the directory entry created by a rename to disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// checkFileInfo returns a *PermissionError if the file described by fi can be
+// read or written by anyone other than its owner, or if its owner is not the
+// current user.
+func checkFileInfo(path string, fi os.FileInfo) error {
+	if perm := fi.Mode().Perm(); perm&0077 != 0 {
+		return &PermissionError{path, perm, fmt.Sprintf("file is accessible by group or others (mode %04o)", perm)}
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Geteuid() {
+		return &PermissionError{path, fi.Mode().Perm(), "file is not owned by the current user"}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package netrc
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// The methods in this file keep secrets out of logs and other output by
+// default: a Machine or Netrc printed with the fmt package or logged with
+// log/slog shows every password, passwordeval command and account as
+// "********". Machine.Reveal and Netrc.MarshalText give the real values when
+// they are needed.
+//
+// The methods have pointer receivers, since they take the lock of the Netrc
+// a Machine belongs to, so only a *Machine is masked. A Machine value, as in
+// fmt.Println(*m), is printed field by field like any other struct, with its
+// password in clear; print m itself instead.
+
+// String returns m in netrc syntax, as on a single line of a netrc file,
+// with its password and account masked.
+func (m *Machine) String() string {
+	if m == nil {
+		return "<nil>"
+	}
+	return m.snapshot().text(true)
+}
+
+// Reveal is like String but includes m's password and account.
+func (m *Machine) Reveal() string {
+	if m == nil {
+		return "<nil>"
+	}
+	return m.snapshot().text(false)
+}
+
+// GoString returns a Go representation of m, with its password, passwordeval
+// command and account masked. It implements the fmt.GoStringer interface.
+func (m *Machine) GoString() string {
+	if m == nil {
+		return "(*netrc.Machine)(nil)"
+	}
+	c := m.snapshot()
+	return fmt.Sprintf("&netrc.Machine{Name:%q, Login:%q, Password:%q, Account:%q, Port:%q, PasswordEval:%q}",
+		c.Name, c.Login, maskValue(c.Password), maskValue(c.Account), c.Port, maskValue(c.PasswordEval))
+}
+
+// Format implements the fmt.Formatter interface so that m's password and
+// account are masked whatever verb is used. The %#v verb gives the result
+// of GoString, %q gives the result of String quoted, and any other verb
+// gives the result of String. A Machine value is not masked; see above.
+func (m *Machine) Format(f fmt.State, verb rune) {
+	formatRedacted(f, verb, m.String, m.GoString)
+}
+
+// LogValue implements the slog.LogValuer interface, logging m as a group
+// with its password and account masked.
+func (m *Machine) LogValue() slog.Value {
+	if m == nil {
+		return slog.Value{}
+	}
+	c := m.snapshot()
+	attrs := []slog.Attr{slog.String("name", c.Name)}
+	if c.IsDefault() {
+		attrs = []slog.Attr{slog.Bool("default", true)}
+	}
+	for _, f := range []struct{ key, value string }{
+		{"login", c.Login},
+		{"password", maskValue(c.Password)},
+		{"passwordeval", maskValue(c.PasswordEval)},
+		{"account", maskValue(c.Account)},
+		{"port", c.Port},
+	} {
+		if f.value != "" {
+			attrs = append(attrs, slog.String(f.key, f.value))
+		}
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// text returns m in netrc syntax, with its password and account masked if
+// redact is true.
+func (m *Machine) text(redact bool) string {
+	var b strings.Builder
+	if m.IsDefault() {
+		b.WriteString("default")
+	} else {
+		b.WriteString("machine " + QuoteValue(m.Name))
+	}
+	password, eval, account := m.Password, m.PasswordEval, m.Account
+	if redact {
+		password, eval, account = maskValue(password), maskValue(eval), maskValue(account)
+	}
+	for _, f := range []struct{ keyword, value string }{
+		{"login", m.Login},
+		{"password", password},
+		{"passwordeval", eval},
+		{"account", account},
+		{"port", m.Port},
+	} {
+		if f.value != "" {
+			b.WriteString(" " + f.keyword + " " + QuoteValue(f.value))
+		}
+	}
+	return b.String()
+}
+
+// String returns the text of n, as from MarshalText, with every password
+// and account masked.
+func (n *Netrc) String() string {
+	if n == nil {
+		return "<nil>"
+	}
+	n.updateLock.RLock()
+	defer n.updateLock.RUnlock()
+	return string(n.marshal(tkPassword, tkPasswordEval, tkAccount))
+}
+
+// GoString returns a Go representation of n, with every password and
+// account masked. It implements the fmt.GoStringer interface.
+func (n *Netrc) GoString() string {
+	if n == nil {
+		return "(*netrc.Netrc)(nil)"
+	}
+	n.updateLock.RLock()
+	machines := append([]*Machine(nil), n.machines...)
+	path := n.path
+	n.updateLock.RUnlock()
+
+	ms := make([]string, len(machines))
+	for i, m := range machines {
+		ms[i] = m.GoString()
+	}
+	return fmt.Sprintf("&netrc.Netrc{Path:%q, Machines:[]*netrc.Machine{%s}}", path, strings.Join(ms, ", "))
+}
+
+// Format implements the fmt.Formatter interface so that n's passwords and
+// accounts are masked whatever verb is used, as with Machine.Format.
+func (n *Netrc) Format(f fmt.State, verb rune) {
+	formatRedacted(f, verb, n.String, n.GoString)
+}
+
+// LogValue implements the slog.LogValuer interface, logging n as a group
+// holding its path and the names of its machines. No passwords or accounts
+// are logged.
+func (n *Netrc) LogValue() slog.Value {
+	if n == nil {
+		return slog.Value{}
+	}
+	n.updateLock.RLock()
+	defer n.updateLock.RUnlock()
+
+	names := make([]string, 0, len(n.machines))
+	for _, m := range n.machines {
+		if !m.IsDefault() {
+			names = append(names, m.Name)
+		}
+	}
+	return slog.GroupValue(
+		slog.String("path", n.path),
+		slog.Any("machines", names),
+		slog.Bool("default", n.defaultMachine() != nil),
+	)
+}
+
+// Redacted returns a copy of n in which every password and account is
+// replaced by "********". The copy's MarshalText output is the same as n's
+// but for those values. It is not associated with n's file, so saving it
+// cannot overwrite the real credentials.
+func (n *Netrc) Redacted() *Netrc {
+	n.updateLock.RLock()
+	c := n.clone()
+	n.updateLock.RUnlock()
+
+	c.path, c.crypter = "", nil
+	c.transformValues([]tkType{tkPassword, tkPasswordEval, tkAccount}, func(_ *Machine, kind tkType, value string) (string, bool, error) {
+		return mask, true, nil
+	})
+	return c
+}
+
+func formatRedacted(f fmt.State, verb rune, str, gostr func() string) {
+	switch {
+	case verb == 'v' && f.Flag('#'):
+		fmt.Fprint(f, gostr())
+	case verb == 'q':
+		fmt.Fprintf(f, "%q", str())
+	default:
+		fmt.Fprint(f, str())
+	}
+}
@@ -1,3 +1,3 @@
 module toolman.org/file/netrc
 
-go 1.12
+go 1.21
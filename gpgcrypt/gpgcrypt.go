@@ -0,0 +1,145 @@
+// Package gpgcrypt provides a netrc.Crypter for files encrypted with GnuPG,
+// such as the ~/.authinfo.gpg used by Emacs, so that they can be read and
+// saved with the netrc package without ever writing the plaintext to disk:
+//
+//	c := &gpgcrypt.Crypter{}
+//	n, err := netrc.ParseFileWithOptions(path, netrc.ParseFileOptions{Crypter: c})
+//	if err != nil { ... }
+//	n.FindMachine("example.com").UpdatePassword(newpass)
+//	err = n.Save() // re-encrypted to the keys the file was encrypted to
+//
+// The gpg program does the work, so keys, passphrases and the agent are
+// handled as they are for gpg itself. Data is passed to and from gpg
+// through pipes.
+package gpgcrypt // import "toolman.org/file/netrc/gpgcrypt"
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+const armorHeader = "-----BEGIN PGP MESSAGE-----"
+
+// Crypter is a netrc.Crypter for files encrypted to public keys with gpg.
+// Both binary and ASCII armored files can be decrypted. The zero value is
+// ready to use.
+type Crypter struct {
+	// Command is the gpg program to run. If empty, "gpg" is found on the
+	// PATH.
+	Command string
+
+	// Args are passed to gpg before any others, for example
+	// []string{"--homedir", dir}.
+	Args []string
+
+	// Recipients are the keys files are encrypted to when saved, in any
+	// form gpg's --recipient option accepts. If empty, files are
+	// encrypted to the keys of the last file decrypted, so that everyone
+	// who could read it before it was saved can still read it.
+	Recipients []string
+
+	// Armor causes files to be saved in the ASCII armored format.
+	Armor bool
+
+	mu     sync.Mutex
+	keyIDs []string // keys the last file decrypted was encrypted to
+}
+
+// IsEncrypted reports whether data is an OpenPGP message encrypted to a
+// public key or with a passphrase.
+func (c *Crypter) IsEncrypted(data []byte) bool {
+	if bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte(armorHeader)) {
+		return true
+	}
+	if len(data) == 0 || data[0]&0x80 == 0 {
+		return false
+	}
+	// the first packet of an encrypted message holds a session key
+	var tag byte
+	if data[0]&0x40 != 0 {
+		tag = data[0] & 0x3f // new format
+	} else {
+		tag = data[0] >> 2 & 0x0f // old format
+	}
+	return tag == 1 || tag == 3
+}
+
+// Decrypt returns the plaintext of the OpenPGP message ciphertext, and
+// remembers the keys it was encrypted to for Encrypt.
+func (c *Crypter) Decrypt(ciphertext []byte) ([]byte, error) {
+	out, status, err := c.run(ciphertext, "--status-fd", "2", "--decrypt")
+	if err != nil {
+		return nil, err
+	}
+	var keyIDs []string
+	for _, line := range status {
+		// [GNUPG:] ENC_TO <long keyid> <keytype> <keylength>
+		if f := strings.Fields(line); len(f) > 1 && f[0] == "ENC_TO" && strings.Trim(f[1], "0") != "" {
+			keyIDs = append(keyIDs, f[1])
+		}
+	}
+	c.mu.Lock()
+	c.keyIDs = keyIDs
+	c.mu.Unlock()
+	return out, nil
+}
+
+// Encrypt returns plaintext encrypted to c's Recipients, or to the keys of
+// the last file decrypted if c has none.
+func (c *Crypter) Encrypt(plaintext []byte) ([]byte, error) {
+	recipients := c.Recipients
+	if len(recipients) == 0 {
+		c.mu.Lock()
+		recipients = c.keyIDs
+		c.mu.Unlock()
+	}
+	if len(recipients) == 0 {
+		return nil, errors.New("gpgcrypt: no recipients to encrypt to")
+	}
+	args := []string{"--encrypt"}
+	if c.Armor {
+		args = append(args, "--armor")
+	}
+	for _, r := range recipients {
+		args = append(args, "--recipient", r)
+	}
+	out, _, err := c.run(plaintext, args...)
+	return out, err
+}
+
+// run runs gpg with args, passing it stdin, and returns its output and the
+// status lines it wrote to stderr, without their "[GNUPG:] " prefix.
+func (c *Crypter) run(stdin []byte, args ...string) ([]byte, []string, error) {
+	command := c.Command
+	if command == "" {
+		command = "gpg"
+	}
+	args = append(append([]string{"--batch", "--quiet", "--yes"}, c.Args...), args...)
+	cmd := exec.Command(command, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+
+	var status, msgs []string
+	scanner := bufio.NewScanner(&stderr)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "[GNUPG:] ") {
+			status = append(status, strings.TrimPrefix(line, "[GNUPG:] "))
+		} else if line != "" {
+			msgs = append(msgs, line)
+		}
+	}
+	if err != nil {
+		if len(msgs) > 0 {
+			return nil, nil, fmt.Errorf("gpgcrypt: %s: %w: %s", command, err, strings.Join(msgs, "; "))
+		}
+		return nil, nil, fmt.Errorf("gpgcrypt: %s: %w", command, err)
+	}
+	return out, status, nil
+}
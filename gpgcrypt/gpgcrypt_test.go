@@ -0,0 +1,120 @@
+package gpgcrypt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"toolman.org/file/netrc"
+)
+
+func TestRoundTrip(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not found")
+	}
+	dir, err := ioutil.TempDir("", "gpgcrypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	home := filepath.Join(dir, "gnupg")
+	if err := os.Mkdir(home, 0700); err != nil {
+		t.Fatal(err)
+	}
+	defer exec.Command("gpgconf", "--homedir", home, "--kill", "gpg-agent").Run()
+
+	args := []string{"--homedir", home}
+	for _, uid := range []string{"alice@example.com", "bob@example.com"} {
+		gen := append(append([]string{"--batch", "--passphrase", ""}, args...), "--quick-gen-key", uid, "default", "default", "never")
+		if out, err := exec.Command("gpg", gen...).CombinedOutput(); err != nil {
+			t.Fatalf("generating key for %s: %v\n%s", uid, err, out)
+		}
+	}
+
+	for _, armor := range []bool{false, true} {
+		path := filepath.Join(dir, "authinfo.gpg")
+		c := &Crypter{Args: args, Recipients: []string{"alice@example.com", "bob@example.com"}, Armor: armor}
+		n, err := netrc.Parse(strings.NewReader("# work\nmachine example.com login me password first-secret\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.SetCrypter(c)
+		if err := n.WriteFile(path); err != nil {
+			t.Fatal(err)
+		}
+		checkEncrypted(t, c, path)
+
+		// a Crypter without Recipients saves to the keys the file had
+		reader := &Crypter{Args: args, Armor: armor}
+		n, err = netrc.ParseFileWithOptions(path, netrc.ParseFileOptions{Crypter: reader})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reader.keyIDs) != 2 {
+			t.Errorf("expected 2 recipient keys, got %v", reader.keyIDs)
+		}
+		m := n.FindMachine("example.com")
+		if m == nil || m.Password != "first-secret" {
+			t.Fatalf("expected machine with password first-secret, got %+v", m)
+		}
+		m.UpdatePassword("second-secret")
+		if err := n.Save(); err != nil {
+			t.Fatal(err)
+		}
+		checkEncrypted(t, c, path)
+
+		check := &Crypter{Args: args}
+		n, err = netrc.ParseFileWithOptions(path, netrc.ParseFileOptions{Crypter: check})
+		if err != nil {
+			t.Fatal(err)
+		}
+		text, _ := n.MarshalText()
+		if want := "# work\nmachine example.com login me password second-secret\n"; string(text) != want {
+			t.Errorf("expected %q, got %q", want, text)
+		}
+		if len(check.keyIDs) != 2 {
+			t.Errorf("expected the saved file to keep 2 recipient keys, got %v", check.keyIDs)
+		}
+	}
+
+	if _, err := (&Crypter{Args: args}).Encrypt([]byte("machine a")); err == nil {
+		t.Error("expected an error encrypting without recipients")
+	}
+}
+
+func TestIsEncrypted(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want bool
+	}{
+		{[]byte("machine example.com login me\n"), false},
+		{[]byte("\n" + armorHeader + "\n"), true},
+		{[]byte{0x85, 0x01}, true},  // old format public-key encrypted session key
+		{[]byte{0xc3, 0x0d}, true},  // new format symmetric-key encrypted session key
+		{[]byte{0xa3, 0x01}, false}, // compressed data, not encrypted
+		{nil, false},
+	}
+	for _, test := range tests {
+		if got := (&Crypter{}).IsEncrypted(test.data); got != test.want {
+			t.Errorf("IsEncrypted(%q): expected %v, got %v", test.data, test.want, got)
+		}
+	}
+}
+
+func checkEncrypted(t *testing.T, c *Crypter, path string) {
+	t.Helper()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.IsEncrypted(b) || bytes.Contains(b, []byte("secret")) || bytes.Contains(b, []byte("example.com")) {
+		t.Errorf("%s is not encrypted:\n%s", path, b)
+	}
+	if c.Armor != bytes.HasPrefix(b, []byte(armorHeader)) {
+		t.Errorf("%s: expected armor %v", path, c.Armor)
+	}
+}
@@ -0,0 +1,128 @@
+package netrc
+
+import (
+	"bytes"
+	"os"
+	"sync"
+)
+
+// LayerOrder determines which layer takes priority when a machine is
+// defined in more than one of a set of Layers.
+type LayerOrder int
+
+const (
+	// FirstMatchWins gives priority to layers that come first.
+	FirstMatchWins LayerOrder = iota
+
+	// LastMatchWins gives priority to layers that come last, so that later
+	// files override earlier ones.
+	LastMatchWins
+)
+
+// Layers combines several netrc files, such as a shared team file, a user's
+// ~/.netrc and per-project overrides, into a single view. Each file remains
+// a separate Netrc: a Machine found through Layers belongs to the Netrc of
+// the file that defines it, reports that file through its Source method, and
+// is written back to that file by Save.
+type Layers struct {
+	order  LayerOrder
+	layers []*Netrc
+	saved  [][]byte // text of each layer when last loaded or saved
+
+	saveLock sync.Mutex // guards saved
+}
+
+// ParseLayers parses each of the named files and returns them as Layers.
+// Files that do not exist are skipped, so optional layers can be listed
+// unconditionally; any other error is returned.
+func ParseLayers(order LayerOrder, filenames ...string) (*Layers, error) {
+	var layers []*Netrc
+	for _, filename := range filenames {
+		n, err := ParseFile(filename)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, n)
+	}
+	return NewLayers(order, layers...), nil
+}
+
+// NewLayers returns Layers made up of the given Netrc values.
+func NewLayers(order LayerOrder, layers ...*Netrc) *Layers {
+	l := &Layers{order: order, layers: layers, saved: make([][]byte, len(layers))}
+	for i, n := range layers {
+		l.saved[i], _ = n.MarshalText()
+	}
+	return l
+}
+
+// Layers returns the individual layers, in the order they were given.
+func (l *Layers) Layers() []*Netrc {
+	return append([]*Netrc(nil), l.layers...)
+}
+
+// FindMachine returns the Machine named by name from the layer with the
+// highest priority that defines it. If no layer defines it, the ``default''
+// machine from the highest priority layer that has one is returned.
+// Otherwise, nil is returned.
+func (l *Layers) FindMachine(name string) *Machine {
+	var def *Machine
+	for _, n := range l.byPriority() {
+		m := n.FindMachine(name)
+		switch {
+		case m == nil:
+		case !m.IsDefault():
+			return m
+		case def == nil:
+			def = m
+		}
+	}
+	return def
+}
+
+// Visit calls vfunc for each Machine in each layer, in priority order,
+// stopping at the first error, which is returned.
+func (l *Layers) Visit(vfunc func(*Machine) error) error {
+	for _, n := range l.byPriority() {
+		if err := n.Visit(vfunc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save writes back each layer that has changed since it was loaded or last
+// saved, as with Netrc.Save. Unchanged files are left alone.
+func (l *Layers) Save() error {
+	l.saveLock.Lock()
+	defer l.saveLock.Unlock()
+
+	for i, n := range l.layers {
+		text, err := n.MarshalText()
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(text, l.saved[i]) {
+			continue
+		}
+		if err := n.Save(); err != nil {
+			return err
+		}
+		l.saved[i] = text
+	}
+	return nil
+}
+
+func (l *Layers) byPriority() []*Netrc {
+	if l.order == FirstMatchWins {
+		return l.layers
+	}
+	reversed := make([]*Netrc, len(l.layers))
+	for i, n := range l.layers {
+		reversed[len(l.layers)-1-i] = n
+	}
+	return reversed
+}
@@ -1,6 +1,7 @@
 package netrc
 
 import (
+	"fmt"
 	"strings"
 )
 
@@ -10,17 +11,36 @@ type Machine struct {
 	Login    string
 	Password string
 	Account  string
+	Port     string // authinfo dialect only
+
+	// PasswordEval is the command whose output is the password, for a
+	// machine that gives one with msmtp's passwordeval keyword rather than
+	// a password; see StandardResolver. At most one of Password and
+	// PasswordEval is set.
+	PasswordEval string
 
 	nametoken    *token
 	logintoken   *token
 	passtoken    *token
 	accounttoken *token
+	porttoken    *token
+
+	netrc *Netrc
+	line  int // line number of the machine's first token when parsed
 }
 
+// NewMachine adds a machine named name with the given login, password and
+// account to n, before the ``default'' machine if there is one, and returns
+// it. Empty values are left out. If name is empty, the ``default'' machine
+// is set instead, as by SetDefault.
 func (n *Netrc) NewMachine(name, login, password, account string) *Machine {
 	n.updateLock.Lock()
 	defer n.updateLock.Unlock()
 
+	if name == "" {
+		return n.setDefault(login, password, account)
+	}
+
 	prefix := "\n"
 	if len(n.tokens) == 0 {
 		prefix = ""
@@ -30,36 +50,37 @@ func (n *Netrc) NewMachine(name, login, password, account string) *Machine {
 		Login:    login,
 		Password: password,
 		Account:  account,
+		netrc:    n,
 
 		nametoken: &token{
 			kind:     tkMachine,
 			rawkind:  []byte(prefix + "machine"),
 			value:    name,
-			rawvalue: []byte(" " + name),
+			rawvalue: []byte(" " + QuoteValue(name)),
 		},
 		logintoken: &token{
 			kind:     tkLogin,
 			rawkind:  []byte("\n\tlogin"),
 			value:    login,
-			rawvalue: []byte(" " + login),
+			rawvalue: []byte(" " + QuoteValue(login)),
 		},
 		passtoken: &token{
 			kind:     tkPassword,
 			rawkind:  []byte("\n\tpassword"),
 			value:    password,
-			rawvalue: []byte(" " + password),
+			rawvalue: []byte(" " + QuoteValue(password)),
 		},
 		accounttoken: &token{
 			kind:     tkAccount,
 			rawkind:  []byte("\n\taccount"),
 			value:    account,
-			rawvalue: []byte(" " + account),
+			rawvalue: []byte(" " + QuoteValue(account)),
 		},
 	}
 	n.insertMachineTokensBeforeDefault(m)
 	for i := range n.machines {
 		if n.machines[i].IsDefault() {
-			n.machines = append(append(n.machines[:i], m), n.machines[i:]...)
+			n.machines = append(n.machines[:i], append([]*Machine{m}, n.machines[i:]...)...)
 			return m
 		}
 	}
@@ -67,28 +88,369 @@ func (n *Netrc) NewMachine(name, login, password, account string) *Machine {
 	return m
 }
 
+// SetDefault sets the login, password and account of the ``default''
+// machine of n and returns it. If n has no ``default'' machine, one is added
+// after every other machine. Otherwise its fields are updated in place, and
+// any field set to an empty value is removed.
+func (n *Netrc) SetDefault(login, password, account string) *Machine {
+	n.updateLock.Lock()
+	defer n.updateLock.Unlock()
+	return n.setDefault(login, password, account)
+}
+
+func (n *Netrc) setDefault(login, password, account string) *Machine {
+	m := n.defaultMachine()
+	if m == nil {
+		prefix := "\n"
+		if len(n.tokens) == 0 {
+			prefix = ""
+		}
+		m = &Machine{
+			netrc:     n,
+			nametoken: &token{kind: tkDefault, rawkind: []byte(prefix + "default")},
+		}
+		// a default must follow every machine, and machines are only ever
+		// added before it, so the end of the file is always a safe place
+		n.tokens = append(n.tokens, m.nametoken)
+		n.fixLeadingSpace(len(n.tokens) - 1)
+		n.machines = append(n.machines, m)
+	}
+
+	fields := []struct {
+		kind    tkType
+		keyword string
+		value   string
+	}{
+		{tkLogin, "login", login},
+		{tkPassword, "password", password},
+		{tkAccount, "account", account},
+	}
+	for _, f := range fields {
+		field, tp := m.fieldRefs(f.kind)
+		if f.value == "" {
+			m.clearTokenLocked(field, tp)
+			continue
+		}
+		m.setTokenLocked(field, tp, f.kind, f.keyword, f.value)
+	}
+	return m
+}
+
+// RemoveDefault removes the ``default'' machine from n, if it has one.
+func (n *Netrc) RemoveDefault() {
+	n.updateLock.Lock()
+	defer n.updateLock.Unlock()
+
+	m := n.defaultMachine()
+	if m == nil {
+		return
+	}
+	for _, t := range m.tokens() {
+		n.removeToken(t)
+	}
+	for i := range n.machines {
+		if n.machines[i] == m {
+			n.machines = append(n.machines[:i], n.machines[i+1:]...)
+			break
+		}
+	}
+}
+
+// defaultMachine returns the ``default'' machine of n, or nil if there is
+// none. The caller must hold n's lock.
+func (n *Netrc) defaultMachine() *Machine {
+	for _, m := range n.machines {
+		if m.IsDefault() {
+			return m
+		}
+	}
+	return nil
+}
+
 // IsDefault returns true if the machine is a "default" token, denoted by an
 // empty name.
 func (m *Machine) IsDefault() bool {
 	return m.Name == ""
 }
 
-// UpdatePassword sets the password for the Machine m.
+// Source returns the name of the file m was read from and the line on which
+// its definition began. The filename is empty if m's Netrc is not associated
+// with a file, and the line is 0 if m was not read from a file or text but
+// added with NewMachine. Line numbers are not updated as the file changes.
+func (m *Machine) Source() (filename string, line int) {
+	if n := m.netrc; n != nil {
+		n.updateLock.RLock()
+		defer n.updateLock.RUnlock()
+		filename = n.path
+	}
+	return filename, m.line
+}
+
+// Rename changes the name of m to newName, keeping its other fields and the
+// formatting around its name. The ``default'' machine cannot be renamed, and
+// newName may not be empty.
+func (m *Machine) Rename(newName string) error {
+	if n := m.netrc; n != nil {
+		n.updateLock.Lock()
+		defer n.updateLock.Unlock()
+	}
+	if m.IsDefault() {
+		return fmt.Errorf("netrc: cannot rename the default machine")
+	}
+	if newName == "" {
+		return fmt.Errorf("netrc: cannot rename machine %q to an empty name", m.Name)
+	}
+	m.Name = newName
+	if m.nametoken != nil { // m may not belong to a Netrc
+		updateTokenValue(m.nametoken, newName)
+	}
+	return nil
+}
+
+// Remove removes m, and the tokens that make it up, from the Netrc it
+// belongs to. Unlike RemoveMachine, it removes exactly m even if other
+// machines have the same name. Afterwards m no longer belongs to a Netrc, as
+// with every machine removed from one.
+func (m *Machine) Remove() {
+	n := m.netrc
+	if n == nil {
+		return
+	}
+	n.updateLock.Lock()
+	defer n.updateLock.Unlock()
+
+	if i := n.machineIndex(m); i >= 0 {
+		n.removeMachineAt(i)
+	}
+}
+
+// MoveBefore moves m, with any comment lines directly above it, so that it
+// comes just before o and any comment lines directly above o. Both machines
+// must belong to the same Netrc. Since the ``default'' machine must come
+// after every other machine, it cannot be moved.
+func (m *Machine) MoveBefore(o *Machine) error {
+	return m.move(o, false)
+}
+
+// MoveAfter moves m, with any comment lines directly above it, so that it
+// comes just after o. Both machines must belong to the same Netrc, and
+// neither may be the ``default'' machine.
+func (m *Machine) MoveAfter(o *Machine) error {
+	return m.move(o, true)
+}
+
+func (m *Machine) move(o *Machine, after bool) error {
+	n := m.netrc
+	if n == nil || o.netrc != n {
+		return fmt.Errorf("netrc: machines %q and %q are not in the same netrc", m.Name, o.Name)
+	}
+	n.updateLock.Lock()
+	defer n.updateLock.Unlock()
+
+	if m.IsDefault() {
+		return fmt.Errorf("netrc: cannot move the default machine")
+	}
+	if after && o.IsDefault() {
+		return fmt.Errorf("netrc: cannot move machine %q after the default machine", m.Name)
+	}
+	mi, oi := n.machineIndex(m), n.machineIndex(o)
+	if mi < 0 || oi < 0 {
+		return fmt.Errorf("netrc: machines %q and %q are not in the same netrc", m.Name, o.Name)
+	}
+	if m == o {
+		return nil
+	}
+
+	n.moveBlock(m, o, after)
+
+	n.machines = append(n.machines[:mi], n.machines[mi+1:]...)
+	if oi = n.machineIndex(o); after {
+		oi++
+	}
+	n.machines = append(n.machines[:oi], append([]*Machine{m}, n.machines[oi:]...)...)
+	return nil
+}
+
+// UpdatePassword sets the password for the Machine m. If m has no password
+// token, one is added after the last of m's existing tokens. A passwordeval
+// command is replaced, keyword and all, by the password.
 func (m *Machine) UpdatePassword(newpass string) {
-	m.Password = newpass
-	updateTokenValue(m.passtoken, newpass)
+	m.setToken(&m.Password, &m.passtoken, tkPassword, "password", newpass)
+}
+
+// UpdatePasswordEval sets the command that m's password is read from, as
+// with msmtp's passwordeval keyword. Any password m has is replaced, keyword
+// and all, by the command.
+func (m *Machine) UpdatePasswordEval(command string) {
+	m.setToken(&m.PasswordEval, &m.passtoken, tkPasswordEval, "passwordeval", command)
 }
 
-// UpdateLogin sets the login for the Machine m.
+// UpdateLogin sets the login for the Machine m. If m has no login token, one
+// is added after the last of m's existing tokens.
 func (m *Machine) UpdateLogin(newlogin string) {
-	m.Login = newlogin
-	updateTokenValue(m.logintoken, newlogin)
+	m.setToken(&m.Login, &m.logintoken, tkLogin, "login", newlogin)
 }
 
-// UpdateAccount sets the login for the Machine m.
+// UpdateAccount sets the account for the Machine m. If m has no account
+// token, one is added after the last of m's existing tokens.
 func (m *Machine) UpdateAccount(newaccount string) {
-	m.Account = newaccount
-	updateTokenValue(m.accounttoken, newaccount)
+	m.setToken(&m.Account, &m.accounttoken, tkAccount, "account", newaccount)
+}
+
+// UpdatePort sets the port for the Machine m. If m has no port token, one is
+// added after the last of m's existing tokens. Ports are only understood by
+// the authinfo dialect; see DialectAuthinfo.
+func (m *Machine) UpdatePort(newport string) {
+	m.setToken(&m.Port, &m.porttoken, tkPort, "port", newport)
+}
+
+// RemovePassword removes the password token from m, rather than leaving it
+// in place with an empty value. A passwordeval command is removed as well.
+func (m *Machine) RemovePassword() {
+	m.clearToken(&m.Password, &m.passtoken)
+}
+
+// RemoveLogin removes the login token from m, rather than leaving it in place
+// with an empty value.
+func (m *Machine) RemoveLogin() {
+	m.clearToken(&m.Login, &m.logintoken)
+}
+
+// RemoveAccount removes the account token from m, rather than leaving it in
+// place with an empty value.
+func (m *Machine) RemoveAccount() {
+	m.clearToken(&m.Account, &m.accounttoken)
+}
+
+// setToken sets *field and the value of the token at *tp, creating the
+// token if necessary. Tokens that have a value but are not yet part of m's
+// Netrc are inserted after m's last token.
+func (m *Machine) setToken(field *string, tp **token, kind tkType, keyword, value string) {
+	if n := m.netrc; n != nil {
+		n.updateLock.Lock()
+		defer n.updateLock.Unlock()
+	}
+	m.setTokenLocked(field, tp, kind, keyword, value)
+}
+
+// setTokenLocked is like setToken but requires the caller to hold the lock
+// of m's Netrc.
+func (m *Machine) setTokenLocked(field *string, tp **token, kind tkType, keyword, value string) {
+	if t := *tp; t != nil && t.kind != kind {
+		// password and passwordeval share a token; switch it to the
+		// other keyword and clear the field it held
+		if other, _ := m.fieldRefs(t.kind); other != nil {
+			*other = ""
+		}
+		t.kind = kind
+		t.rawkind = append(append([]byte(nil), leadingSpace(t.rawkind)...), keyword...)
+	}
+	*field = value
+	if *tp == nil {
+		*tp = &token{
+			kind:     kind,
+			rawkind:  []byte(m.fieldPrefix() + keyword),
+			rawvalue: []byte(" "),
+		}
+	}
+	updateTokenValue(*tp, value)
+	if n := m.netrc; n != nil && value != "" && n.tokenIndex(*tp) < 0 {
+		n.insertMachineToken(m, *tp)
+	}
+}
+
+func (m *Machine) clearToken(field *string, tp **token) {
+	if n := m.netrc; n != nil {
+		n.updateLock.Lock()
+		defer n.updateLock.Unlock()
+	}
+	m.clearTokenLocked(field, tp)
+}
+
+// clearTokenLocked is like clearToken but requires the caller to hold the
+// lock of m's Netrc.
+func (m *Machine) clearTokenLocked(field *string, tp **token) {
+	if n := m.netrc; n != nil {
+		n.removeToken(*tp)
+	}
+	if t := *tp; t != nil {
+		// the token may hold a different field, as passwordeval does
+		if f, _ := m.fieldRefs(t.kind); f != nil {
+			*f = ""
+		}
+	}
+	*field = ""
+	*tp = nil
+}
+
+// RemovePort removes the port token from m, rather than leaving it in place
+// with an empty value.
+func (m *Machine) RemovePort() {
+	m.clearToken(&m.Port, &m.porttoken)
+}
+
+// fieldPrefix returns the whitespace to put before a new field keyword so
+// that it follows the layout of m's existing fields: on its own line with
+// the same indentation if they are each on their own line, or separated by
+// a single space if m is written on one line.
+func (m *Machine) fieldPrefix() string {
+	n := m.netrc
+	if n == nil {
+		return " "
+	}
+	var last *token
+	lastIdx := -1
+	for _, t := range []*token{m.logintoken, m.passtoken, m.accounttoken, m.porttoken} {
+		if i := n.tokenIndex(t); i > lastIdx {
+			last, lastIdx = t, i
+		}
+	}
+	if last == nil {
+		return " "
+	}
+	prefix := string(leadingSpace(last.rawkind))
+	if i := strings.LastIndexByte(prefix, '\n'); i >= 0 {
+		if i > 0 && prefix[i-1] == '\r' {
+			i-- // keep CRLF line endings
+		}
+		return prefix[i:]
+	}
+	return " "
+}
+
+// fieldRefs returns pointers to the field and token of m that hold values
+// for tokens of the given kind.
+func (m *Machine) fieldRefs(kind tkType) (*string, **token) {
+	switch kind {
+	case tkMachine:
+		return &m.Name, &m.nametoken
+	case tkLogin:
+		return &m.Login, &m.logintoken
+	case tkPassword:
+		return &m.Password, &m.passtoken
+	case tkPasswordEval:
+		return &m.PasswordEval, &m.passtoken
+	case tkAccount:
+		return &m.Account, &m.accounttoken
+	case tkPort:
+		return &m.Port, &m.porttoken
+	}
+	panic("netrc: no machine field for token kind")
+}
+
+// tokens returns m's tokens, some of which may be nil.
+func (m *Machine) tokens() []*token {
+	refs := m.tokenRefs()
+	tokens := make([]*token, len(refs))
+	for i, tp := range refs {
+		tokens[i] = *tp
+	}
+	return tokens
+}
+
+// tokenRefs returns pointers to each of m's token fields.
+func (m *Machine) tokenRefs() []**token {
+	return []**token{&m.nametoken, &m.logintoken, &m.passtoken, &m.accounttoken, &m.porttoken}
 }
 
 func (m *Machine) Equal(o *Machine) bool {
@@ -98,12 +460,64 @@ func (m *Machine) Equal(o *Machine) bool {
 	case m == nil || o == nil:
 		return false
 	default:
-		return m.Name == o.Name && m.Login == o.Login && m.Password == o.Password && m.Account == o.Account
+		return m.snapshot().equal(o.snapshot())
+	}
+}
+
+func (m *Machine) equal(o *Machine) bool {
+	return m.Name == o.Name && m.Login == o.Login && m.Password == o.Password && m.PasswordEval == o.PasswordEval && m.Account == o.Account && m.Port == o.Port
+}
+
+// snapshot returns a shallow copy of m made while holding the read lock of
+// the Netrc that m belongs to.
+func (m *Machine) snapshot() *Machine {
+	if n := m.netrc; n != nil {
+		n.updateLock.RLock()
+		defer n.updateLock.RUnlock()
+	}
+	c := *m
+	return &c
+}
+
+// mergeable reports whether none of the fields of o conflict with those of
+// m, so that o can be merged into m by merge.
+func (m *Machine) mergeable(o *Machine) bool {
+	for _, kind := range []tkType{tkLogin, tkPassword, tkAccount} {
+		mf, _ := m.fieldRefs(kind)
+		of, _ := o.fieldRefs(kind)
+		if *mf != "" && *of != "" && *mf != *of {
+			return false
+		}
+	}
+	// a password and a passwordeval command are never merged
+	if m.passtoken != nil && o.passtoken != nil && m.passtoken.kind != o.passtoken.kind {
+		return false
+	}
+	return m.PasswordEval == "" || o.PasswordEval == "" || m.PasswordEval == o.PasswordEval
+}
+
+// merge sets any fields of m that are empty to the values of those fields in
+// o. The caller must hold the lock of m's Netrc.
+func (m *Machine) merge(o *Machine) {
+	fields := []struct {
+		kind    tkType
+		keyword string
+	}{
+		{tkLogin, "login"},
+		{tkPassword, "password"},
+		{tkPasswordEval, "passwordeval"},
+		{tkAccount, "account"},
+	}
+	for _, f := range fields {
+		mf, mt := m.fieldRefs(f.kind)
+		if of, _ := o.fieldRefs(f.kind); *mf == "" && *of != "" {
+			m.setTokenLocked(mf, mt, f.kind, f.keyword, *of)
+		}
 	}
 }
 
 const keysep = "\000"
 
 func (m *Machine) key() string {
-	return strings.Join([]string{m.Login, m.Account, m.Name}, keysep)
+	return strings.Join([]string{m.Login, m.Account, m.Name, m.Port}, keysep)
 }
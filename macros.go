@@ -1,5 +1,11 @@
 package netrc
 
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
 // Macros contains all the macro definitions in a netrc file.
 type Macros map[string]string
 
@@ -26,3 +32,125 @@ func (m Macros) equal(o Macros) bool {
 
 	return true
 }
+
+// Macros returns a copy of all the macro definitions in n, keyed by name.
+func (n *Netrc) Macros() Macros {
+	n.updateLock.RLock()
+	defer n.updateLock.RUnlock()
+
+	m := make(Macros, len(n.macros))
+	for k, v := range n.macros {
+		m[k] = v
+	}
+	return m
+}
+
+// Macro returns the body of the macro named name. The second return value
+// reports whether such a macro is defined.
+func (n *Netrc) Macro(name string) (body string, ok bool) {
+	n.updateLock.RLock()
+	defer n.updateLock.RUnlock()
+
+	body, ok = n.macros[name]
+	return
+}
+
+// NewMacro adds a macdef named name with the given body to the end of n. It
+// returns an error if a macro by that name already exists or if name or body
+// are not valid; since a blank line ends a macro definition, body may not
+// contain one.
+func (n *Netrc) NewMacro(name, body string) error {
+	n.updateLock.Lock()
+	defer n.updateLock.Unlock()
+
+	if err := checkMacro(name, body); err != nil {
+		return err
+	}
+	if _, ok := n.macros[name]; ok {
+		return fmt.Errorf("netrc: macro %q already defined", name)
+	}
+
+	prefix := "\n"
+	switch {
+	case len(n.tokens) == 0:
+		prefix = ""
+	case n.tokens[len(n.tokens)-1].kind == tkMacdef:
+		prefix = "\n\n"
+	}
+	n.tokens = append(n.tokens, &token{
+		kind:      tkMacdef,
+		macroName: name,
+		value:     body,
+		rawkind:   []byte(prefix + "macdef"),
+		rawvalue:  []byte("\n" + body + "\n"),
+	})
+	if n.macros == nil {
+		n.macros = make(Macros)
+	}
+	n.macros[name] = body
+	return nil
+}
+
+// UpdateMacro replaces the body of the existing macro named name. The same
+// restrictions on body apply as for NewMacro.
+func (n *Netrc) UpdateMacro(name, body string) error {
+	n.updateLock.Lock()
+	defer n.updateLock.Unlock()
+
+	if err := checkMacro(name, body); err != nil {
+		return err
+	}
+	t := n.findMacro(name)
+	if t == nil {
+		return fmt.Errorf("netrc: macro %q not defined", name)
+	}
+
+	// keep the newline that separates the body from the name, and any
+	// whitespace that ended the old body
+	raw := string(t.rawvalue)
+	head := raw[:len(raw)-len(strings.TrimLeft(raw, "\r\n"))]
+	if head == "" {
+		head = "\n"
+	}
+	tail := raw[len(strings.TrimRightFunc(raw, unicode.IsSpace)):]
+
+	t.value = body
+	t.rawvalue = []byte(head + body + tail)
+	n.macros[name] = body
+	return nil
+}
+
+// RemoveMacro removes the macro named name from n, if it exists.
+func (n *Netrc) RemoveMacro(name string) {
+	n.updateLock.Lock()
+	defer n.updateLock.Unlock()
+
+	n.removeToken(n.findMacro(name))
+	delete(n.macros, name)
+}
+
+func (n *Netrc) findMacro(name string) *token {
+	for _, t := range n.tokens {
+		if t.kind == tkMacdef && t.macroName == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func (n *Netrc) finishMacro(t *token) {
+	t.value = strings.TrimRight(strings.TrimLeft(string(t.rawvalue), "\r\n"), "\r\n")
+	n.macros[t.macroName] = t.value
+}
+
+func checkMacro(name, body string) error {
+	if name == "" || strings.IndexFunc(name, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("netrc: invalid macro name %q", name)
+	}
+	for _, line := range strings.Split(body, "\n") {
+		if strings.TrimSuffix(line, "\r") == "" {
+			return fmt.Errorf("netrc: macro %q must not contain a blank line", name)
+		}
+	}
+	return nil
+}
@@ -2,14 +2,27 @@ package netrc // import "toolman.org/file/netrc"
 
 import (
 	"bytes"
+	"io"
+	"strings"
 	"sync"
+	"unicode"
 )
 
+// Netrc represents a parsed netrc file. It is safe for concurrent use by
+// multiple goroutines: lookups and MarshalText may run in parallel, while
+// changes, including those made through a Machine's Update and Remove
+// methods, are serialized.
+//
+// The exported fields of a Machine returned from a Netrc are updated in
+// place, so they must not be read while another goroutine may be changing
+// them. Readers that need a consistent view should use Snapshot instead.
 type Netrc struct {
 	tokens     []*token
 	machines   []*Machine
 	macros     Macros
-	updateLock sync.Mutex
+	path       string
+	crypter    Crypter
+	updateLock sync.RWMutex
 }
 
 // FindMachine returns the Machine in n named by name. If a machine named by
@@ -17,7 +30,9 @@ type Netrc struct {
 // is a ``default'' machine, the ``default'' machine is returned. Otherwise, nil
 // is returned.
 func (n *Netrc) FindMachine(name string) (m *Machine) {
-	// TODO(bgentry): not safe for concurrency
+	n.updateLock.RLock()
+	defer n.updateLock.RUnlock()
+
 	var def *Machine
 	for _, m = range n.machines {
 		if m.Name == name {
@@ -33,6 +48,108 @@ func (n *Netrc) FindMachine(name string) (m *Machine) {
 	return def
 }
 
+// Lookup returns the first Machine in n named host whose port and login are
+// compatible with port and login. An empty port or login, whether passed to
+// Lookup or missing from a machine, matches any value. This allows the
+// entries of an authinfo file, which may list the same host several times
+// for different ports, to be told apart. If nothing matches, the ``default''
+// machine is returned if there is one, as with FindMachine.
+func (n *Netrc) Lookup(host, port, login string) *Machine {
+	n.updateLock.RLock()
+	defer n.updateLock.RUnlock()
+
+	var def *Machine
+	for _, m := range n.machines {
+		if m.IsDefault() {
+			def = m
+			continue
+		}
+		if m.Name == host && fieldMatches(m.Port, port) && fieldMatches(m.Login, login) {
+			return m
+		}
+	}
+	return def
+}
+
+// MatchKind describes how the Machine returned by FindMachineWithOptions was
+// chosen.
+type MatchKind int
+
+const (
+	// NoMatch means that no machine was found.
+	NoMatch MatchKind = iota
+
+	// ExactMatch means that a machine with the requested name was found.
+	ExactMatch
+
+	// DefaultMatch means that no machine had the requested name and the
+	// ``default'' machine was returned in its place.
+	DefaultMatch
+)
+
+// LookupOptions controls when FindMachineWithOptions and LookupURLWithOptions
+// may fall back to the ``default'' machine. The zero value allows the
+// fallback for every name, as FindMachine does.
+type LookupOptions struct {
+	// DisableDefault prevents the ``default'' machine from ever being
+	// returned.
+	DisableDefault bool
+
+	// DefaultHosts, if not empty, limits the fallback to the names it
+	// lists. An entry beginning with '.' is a domain suffix that matches
+	// any name ending with it, so ".example.com" matches
+	// "ftp.example.com" but not "example.com". Other entries must match
+	// the whole name. Names are compared without regard to case.
+	DefaultHosts []string
+}
+
+// allowsDefault reports whether opts allow the ``default'' machine to be
+// used for name.
+func (opts *LookupOptions) allowsDefault(name string) bool {
+	if opts.DisableDefault || name == "" {
+		return false
+	}
+	if len(opts.DefaultHosts) == 0 {
+		return true
+	}
+	name = strings.ToLower(name)
+	for _, h := range opts.DefaultHosts {
+		h = strings.ToLower(h)
+		if strings.HasPrefix(h, ".") && strings.HasSuffix(name, h) || name == h {
+			return true
+		}
+	}
+	return false
+}
+
+// FindMachineWithOptions is like FindMachine but uses opts to decide whether
+// the ``default'' machine may be returned when no machine is named by name.
+// The returned MatchKind tells whether the Machine was found by name or is
+// the ``default'' machine, and is NoMatch when the Machine is nil.
+func (n *Netrc) FindMachineWithOptions(name string, opts LookupOptions) (*Machine, MatchKind) {
+	n.updateLock.RLock()
+	defer n.updateLock.RUnlock()
+
+	var def *Machine
+	for _, m := range n.machines {
+		if m.IsDefault() {
+			def = m
+			continue
+		}
+		if m.Name == name {
+			return m, ExactMatch
+		}
+	}
+	if def == nil || !opts.allowsDefault(name) {
+		return nil, NoMatch
+	}
+	return def, DefaultMatch
+}
+
+func fieldMatches(have, want string) bool {
+	return have == "" || want == "" || have == want
+}
+
 // FindMachine parses the netrc file identified by filename and returns the
 // Machine named by name. If a problem occurs parsing the file at filename, an
 // error is returned. If a machine named by name exists, it is returned. If no
@@ -49,23 +166,122 @@ func FindMachine(filename, name string) (m *Machine, err error) {
 // MarshalText implements the encoding.TextMarshaler interface to encode a
 // Netrc into text format.
 func (n *Netrc) MarshalText() (text []byte, err error) {
-	// TODO(bgentry): not safe for concurrency
-	for i := range n.tokens {
-		switch n.tokens[i].kind {
-		case tkComment, tkDefault, tkWhitespace: // always append these types
-			text = append(text, n.tokens[i].rawkind...)
+	n.updateLock.RLock()
+	defer n.updateLock.RUnlock()
+	return n.marshal(), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface to decode
+// text, as by Parse, into n, replacing its machines and macros. If text
+// cannot be parsed, n is left unchanged and the *Error from Parse is
+// returned. The file that n is saved to, if any, is not changed.
+func (n *Netrc) UnmarshalText(text []byte) error {
+	o, err := parse(bytes.NewReader(text), 1, ParseOptions{})
+	if err != nil {
+		return err
+	}
+	n.updateLock.Lock()
+	defer n.updateLock.Unlock()
+	n.replace(o)
+	return nil
+}
+
+// WriteTo implements the io.WriterTo interface, writing the text of n, as
+// from MarshalText, to w. The text is built while n is locked and written
+// once the lock is released, so a slow or blocked w does not hold up changes
+// to n.
+func (n *Netrc) WriteTo(w io.Writer) (int64, error) {
+	text, _ := n.MarshalText()
+	k, err := w.Write(text)
+	return int64(k), err
+}
+
+// ReadFrom implements the io.ReaderFrom interface, reading and parsing a
+// netrc file from r as UnmarshalText does. It returns the number of bytes
+// read.
+func (n *Netrc) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countingReader{r: r}
+	o, err := parse(cr, 1, ParseOptions{})
+	if err != nil {
+		return cr.n, err
+	}
+	n.updateLock.Lock()
+	defer n.updateLock.Unlock()
+	n.replace(o)
+	return cr.n, nil
+}
+
+// replace replaces the contents of n with those of o, which must not be
+// used afterwards. The caller must hold n's lock.
+func (n *Netrc) replace(o *Netrc) {
+	n.tokens, n.machines, n.macros = o.tokens, o.machines, o.macros
+	for _, m := range n.machines {
+		m.netrc = n
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	k, err := cr.r.Read(p)
+	cr.n += int64(k)
+	return k, err
+}
+
+// mask replaces secret values in redacted output.
+const mask = "********"
+
+// marshal returns the text of n, with the values of any tokens of the kinds
+// in redact replaced by mask. The caller must hold n's lock.
+func (n *Netrc) marshal(redact ...tkType) []byte {
+	var buf bytes.Buffer
+	n.writeText(&buf, redact...)
+	return buf.Bytes()
+}
+
+// writeText writes the text of n to w, as described for marshal, stopping at
+// the first error. The caller must hold n's lock.
+func (n *Netrc) writeText(w io.Writer, redact ...tkType) (written int64, err error) {
+	write := func(b []byte) {
+		if err == nil {
+			var k int
+			k, err = w.Write(b)
+			written += int64(k)
+		}
+	}
+	for _, t := range n.tokens {
+		switch t.kind {
+		case tkComment, tkDefault, tkWhitespace, tkInvalid: // always append these types
+			write(t.rawkind)
 		default:
-			if n.tokens[i].value != "" { // skip empty-value tokens
-				text = append(text, n.tokens[i].rawkind...)
+			if t.value != "" { // skip empty-value tokens
+				write(t.rawkind)
 			}
 		}
-		if n.tokens[i].kind == tkMacdef {
-			text = append(text, ' ')
-			text = append(text, n.tokens[i].macroName...)
+		if t.kind == tkMacdef {
+			write([]byte{' '})
+			write([]byte(t.macroName))
+		}
+		if t.value != "" && containsKind(redact, t.kind) {
+			write(leadingSpace(t.rawvalue))
+			write([]byte(mask))
+			continue
 		}
-		text = append(text, n.tokens[i].rawvalue...)
+		write(t.rawvalue)
 	}
-	return
+	return written, err
+}
+
+func containsKind(kinds []tkType, kind tkType) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
 }
 
 func (n *Netrc) insertMachineTokensBeforeDefault(m *Machine) {
@@ -79,36 +295,132 @@ func (n *Netrc) insertMachineTokensBeforeDefault(m *Machine) {
 	if m.accounttoken.value != "" {
 		newtokens = append(newtokens, m.accounttoken)
 	}
-	for i := range n.tokens {
-		if n.tokens[i].kind == tkDefault {
+	i := len(n.tokens) // didn't find a default, just add the newtokens to the end
+	for j := range n.tokens {
+		if n.tokens[j].kind == tkDefault {
 			// found the default, now insert tokens before it
-			n.tokens = append(n.tokens[:i], append(newtokens, n.tokens[i:]...)...)
-			return
+			i = j
+			break
+		}
+	}
+	n.tokens = append(n.tokens[:i], append(newtokens, n.tokens[i:]...)...)
+	if next := i + len(newtokens); next < len(n.tokens) {
+		if i == 0 {
+			swapLeadingSpace(m.nametoken, n.tokens[next])
 		}
+		n.fixLeadingSpace(next)
 	}
-	// didn't find a default, just add the newtokens to the end
-	n.tokens = append(n.tokens, newtokens...)
-	return
+	n.fixLeadingSpace(i)
 }
 
+// RemoveMachine removes the first machine named name from n, if there is
+// one. Use RemoveMachines to remove every machine with that name.
 func (n *Netrc) RemoveMachine(name string) {
 	n.updateLock.Lock()
 	defer n.updateLock.Unlock()
 
 	for i := range n.machines {
 		if n.machines[i] != nil && n.machines[i].Name == name {
-			m := n.machines[i]
-			for _, t := range []*token{
-				m.nametoken, m.logintoken, m.passtoken, m.accounttoken,
-			} {
-				n.removeToken(t)
-			}
-			n.machines = append(n.machines[:i], n.machines[i+1:]...)
+			n.removeMachineAt(i)
 			return
 		}
 	}
 }
 
+// FindMachines returns every machine in n named by name, in the order they
+// appear. Unlike FindMachine, it never returns the ``default'' machine in
+// their place.
+func (n *Netrc) FindMachines(name string) []*Machine {
+	n.updateLock.RLock()
+	defer n.updateLock.RUnlock()
+
+	var found []*Machine
+	for _, m := range n.machines {
+		if m.Name == name && !m.IsDefault() {
+			found = append(found, m)
+		}
+	}
+	return found
+}
+
+// RemoveMachines removes every machine named by name from n and returns the
+// number removed.
+func (n *Netrc) RemoveMachines(name string) int {
+	n.updateLock.Lock()
+	defer n.updateLock.Unlock()
+
+	removed := 0
+	for i := 0; i < len(n.machines); {
+		if n.machines[i].Name == name {
+			n.removeMachineAt(i)
+			removed++
+			continue
+		}
+		i++
+	}
+	return removed
+}
+
+// DedupeOptions controls which machines DedupeWithOptions removes.
+type DedupeOptions struct {
+	// MergePartial causes a machine to be removed when none of its fields
+	// conflict with those of an earlier machine with the same name and
+	// port, rather than only when all of them match. Any fields that it
+	// has and the earlier machine lacks are added to the earlier machine,
+	// which keeps its formatting. For example, "machine a login x"
+	// followed by "machine a password p" become "machine a login x
+	// password p".
+	MergePartial bool
+}
+
+// Dedupe removes machines that exactly repeat an earlier machine, with the
+// same name, port, login, password and account, and returns the number
+// removed. Machines that differ in any field, such as two entries for one
+// host with different logins, are all kept.
+func (n *Netrc) Dedupe() int {
+	return n.DedupeWithOptions(DedupeOptions{})
+}
+
+// DedupeWithOptions is like Dedupe but uses opts to decide which machines
+// count as duplicates.
+func (n *Netrc) DedupeWithOptions(opts DedupeOptions) int {
+	n.updateLock.Lock()
+	defer n.updateLock.Unlock()
+
+	removed := 0
+	for i := 0; i < len(n.machines); i++ {
+		m := n.machines[i]
+		if m.IsDefault() {
+			continue
+		}
+		for j := i + 1; j < len(n.machines); {
+			o := n.machines[j]
+			switch {
+			case m.equal(o):
+			case opts.MergePartial && o.Name == m.Name && o.Port == m.Port && m.mergeable(o):
+				m.merge(o)
+			default:
+				j++
+				continue
+			}
+			n.removeMachineAt(j)
+			removed++
+		}
+	}
+	return removed
+}
+
+// removeMachineAt removes the machine at index i, and its tokens, from n,
+// leaving the machine detached so that later updates to it don't reach n.
+// The caller must hold n's lock.
+func (n *Netrc) removeMachineAt(i int) {
+	for _, t := range n.machines[i].tokens() {
+		n.removeToken(t)
+	}
+	n.machines[i].netrc = nil
+	n.machines = append(n.machines[:i], n.machines[i+1:]...)
+}
+
 func (n *Netrc) Equal(o *Netrc) bool {
 	if n == nil && o == nil {
 		return true
@@ -118,31 +430,42 @@ func (n *Netrc) Equal(o *Netrc) bool {
 		return false
 	}
 
-	nmm := n.machineMap()
-	omm := o.machineMap()
+	if n == o {
+		return true
+	}
+
+	// gather each side separately so that only one lock is held at a time
+	nmm, nmacros := n.equalState()
+	omm, omacros := o.equalState()
 
 	if len(nmm) != len(omm) {
 		return false
 	}
 
-	for k, nm := range nmm {
-		om, ok := omm[k]
-		if !ok || !om.Equal(nm) {
+	for k, nms := range nmm {
+		oms := omm[k]
+		if len(oms) != len(nms) {
 			return false
 		}
-	}
-
-	for k := range omm {
-		if _, ok := nmm[k]; !ok {
-			return false
+		for i := range nms {
+			if !oms[i].equal(nms[i]) {
+				return false
+			}
 		}
 	}
 
-	return n.macros.equal(o.macros)
+	return nmacros.equal(omacros)
 }
 
+// Visit calls vfunc for each Machine in n, in order, stopping at the first
+// error, which is returned. The set of machines visited is fixed when Visit
+// is called, so vfunc may safely modify n.
 func (n *Netrc) Visit(vfunc func(*Machine) error) error {
-	for _, m := range n.machines {
+	n.updateLock.RLock()
+	machines := append([]*Machine(nil), n.machines...)
+	n.updateLock.RUnlock()
+
+	for _, m := range machines {
 		if err := vfunc(m); err != nil {
 			return err
 		}
@@ -150,14 +473,239 @@ func (n *Netrc) Visit(vfunc func(*Machine) error) error {
 	return nil
 }
 
-func (n *Netrc) machineMap() map[string]*Machine {
-	mm := make(map[string]*Machine)
+func (n *Netrc) hasPasswords() bool {
 	for _, m := range n.machines {
-		mm[m.key()] = m
+		if m.Password != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// equalState returns copies of n's machines, grouped as by machineMap, and
+// of its macros.
+func (n *Netrc) equalState() (map[string][]*Machine, Macros) {
+	n.updateLock.RLock()
+	defer n.updateLock.RUnlock()
+
+	mm := n.machineMap()
+	for _, ms := range mm {
+		for i, m := range ms {
+			c := *m
+			ms[i] = &c
+		}
+	}
+	macros := make(Macros, len(n.macros))
+	for k, v := range n.macros {
+		macros[k] = v
+	}
+	return mm, macros
+}
+
+// machineMap groups n's machines by key. Machines that share a key are kept
+// in the order they appear, so that duplicates are not lost.
+func (n *Netrc) machineMap() map[string][]*Machine {
+	mm := make(map[string][]*Machine)
+	for _, m := range n.machines {
+		mm[m.key()] = append(mm[m.key()], m)
 	}
 	return mm
 }
 
+// Snapshot returns a deep copy of n. The copy is not affected by later
+// changes to n, so as long as it is not itself modified, it and its machines
+// can be read from any number of goroutines without further coordination.
+func (n *Netrc) Snapshot() *Netrc {
+	n.updateLock.RLock()
+	defer n.updateLock.RUnlock()
+	return n.clone()
+}
+
+// clone returns a deep copy of n. The caller must hold n's lock.
+func (n *Netrc) clone() *Netrc {
+	c := &Netrc{
+		tokens:   make([]*token, len(n.tokens)),
+		machines: make([]*Machine, len(n.machines)),
+		macros:   make(Macros, len(n.macros)),
+		path:     n.path,
+		crypter:  n.crypter,
+	}
+	copies := make(map[*token]*token, len(n.tokens))
+	cloneToken := func(t *token) *token {
+		if t == nil {
+			return nil
+		}
+		if ct, ok := copies[t]; ok {
+			return ct
+		}
+		ct := *t
+		ct.rawkind = append([]byte(nil), t.rawkind...)
+		ct.rawvalue = append([]byte(nil), t.rawvalue...)
+		copies[t] = &ct
+		return &ct
+	}
+	for i, t := range n.tokens {
+		c.tokens[i] = cloneToken(t)
+	}
+	for i, m := range n.machines {
+		cm := *m
+		cm.netrc = c
+		for _, tp := range cm.tokenRefs() {
+			*tp = cloneToken(*tp)
+		}
+		c.machines[i] = &cm
+	}
+	for k, v := range n.macros {
+		c.macros[k] = v
+	}
+	return c
+}
+
+// insertMachineToken inserts t into n's token list after the last of m's
+// tokens, and after any comment that ends the same line. Nothing is inserted
+// if m has been removed from n, so that a stale Machine cannot add a field
+// to whichever entry now ends the file.
+func (n *Netrc) insertMachineToken(m *Machine, t *token) {
+	if n.tokenIndex(m.nametoken) < 0 {
+		return
+	}
+	i := -1
+	for _, mt := range m.tokens() {
+		if j := n.tokenIndex(mt); j > i {
+			i = j
+		}
+	}
+	i++
+	if i < len(n.tokens) && n.tokens[i].kind == tkComment && !bytes.ContainsRune(leadingSpace(n.tokens[i].rawkind), '\n') {
+		i++
+	}
+	n.tokens = append(n.tokens[:i], append([]*token{t}, n.tokens[i:]...)...)
+}
+
+// machineIndex returns the index of m in n's machines, or -1.
+func (n *Netrc) machineIndex(m *Machine) int {
+	for i := range n.machines {
+		if n.machines[i] == m {
+			return i
+		}
+	}
+	return -1
+}
+
+// block returns the range of n's tokens that make up the entry for m: its
+// own tokens, any comments among or after them on the same lines, and any
+// comment lines directly above it. Comment lines that end the entry belong
+// to whatever follows.
+func (n *Netrc) block(m *Machine) (start, end int) {
+	start = n.tokenIndex(m.nametoken)
+	for end = start + 1; end < len(n.tokens); end++ {
+		if k := n.tokens[end].kind; k == tkMachine || k == tkDefault || k == tkMacdef {
+			break
+		}
+	}
+	for end > start+1 && n.ownLine(end-1) && (n.tokens[end-1].kind == tkComment || n.tokens[end-1].kind == tkWhitespace) {
+		end--
+	}
+	for start > 0 && n.tokens[start-1].kind == tkComment && n.ownLine(start-1) && !hasBlankLine(leadingSpace(n.tokens[start].rawkind)) {
+		start--
+	}
+	return start, end
+}
+
+// moveBlock moves the block of tokens for m to just before the block for o,
+// or just after it if after is true. Each block keeps the whitespace before
+// it, except that whichever block begins the file takes over the whitespace
+// at the start of the file.
+func (n *Netrc) moveBlock(m, o *Machine, after bool) {
+	start, end := n.block(m)
+	moved := append([]*token(nil), n.tokens[start:end]...)
+	n.tokens = append(n.tokens[:start], n.tokens[end:]...)
+	if start < len(n.tokens) {
+		if start == 0 {
+			swapLeadingSpace(moved[0], n.tokens[0])
+		}
+		n.fixLeadingSpace(start)
+	}
+
+	i, oend := n.block(o)
+	if after {
+		i = oend
+	}
+	n.tokens = append(n.tokens[:i], append(moved, n.tokens[i:]...)...)
+	if next := i + len(moved); next < len(n.tokens) {
+		if i == 0 {
+			swapLeadingSpace(moved[0], n.tokens[next])
+		}
+		n.fixLeadingSpace(next)
+	}
+	n.fixLeadingSpace(i)
+}
+
+// ownLine reports whether n's token at index i begins a line.
+func (n *Netrc) ownLine(i int) bool {
+	return i == 0 || bytes.ContainsRune(leadingSpace(n.tokens[i].rawkind), '\n')
+}
+
+// fixLeadingSpace ensures that n's token at index i is not swallowed by the
+// token before it: a comment runs to the end of its line, a macro definition
+// runs to the next blank line, and any other token needs some whitespace
+// after it.
+func (n *Netrc) fixLeadingSpace(i int) {
+	if i == 0 {
+		return
+	}
+	t := n.tokens[i]
+	prefix := leadingSpace(t.rawkind)
+	switch prev := n.tokens[i-1]; prev.kind {
+	case tkComment:
+		if !bytes.ContainsRune(prefix, '\n') {
+			setLeadingSpace(t, []byte("\n"))
+		}
+	case tkMacdef:
+		// the macro text may already end with the first newline of the
+		// blank line
+		if !endsMacro(append(append([]byte(nil), prev.rawvalue...), prefix...)) {
+			if bytes.HasSuffix(prev.rawvalue, []byte("\n")) {
+				setLeadingSpace(t, []byte("\n"))
+			} else {
+				setLeadingSpace(t, []byte("\n\n"))
+			}
+		}
+	case tkWhitespace:
+	default:
+		if len(prefix) == 0 {
+			setLeadingSpace(t, []byte("\n"))
+		}
+	}
+}
+
+func swapLeadingSpace(a, b *token) {
+	ap := append([]byte(nil), leadingSpace(a.rawkind)...)
+	setLeadingSpace(a, leadingSpace(b.rawkind))
+	setLeadingSpace(b, ap)
+}
+
+func setLeadingSpace(t *token, prefix []byte) {
+	rest := t.rawkind[len(leadingSpace(t.rawkind)):]
+	t.rawkind = append(append([]byte(nil), prefix...), rest...)
+}
+
+// hasBlankLine reports whether the whitespace prefix holds a blank line.
+func hasBlankLine(prefix []byte) bool {
+	return bytes.Count(prefix, []byte{'\n'}) > 1
+}
+
+func (n *Netrc) tokenIndex(t *token) int {
+	if t != nil {
+		for i := range n.tokens {
+			if n.tokens[i] == t {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
 func (n *Netrc) removeToken(t *token) {
 	if t != nil {
 		for i := range n.tokens {
@@ -170,12 +718,17 @@ func (n *Netrc) removeToken(t *token) {
 }
 
 func updateTokenValue(t *token, value string) {
-	oldvalue := t.value
 	t.value = value
-	newraw := make([]byte, len(t.rawvalue))
-	copy(newraw, t.rawvalue)
-	t.rawvalue = append(
-		bytes.TrimSuffix(newraw, []byte(oldvalue)),
-		[]byte(value)...,
-	)
+	prefix := leadingSpace(t.rawvalue)
+	newraw := make([]byte, len(prefix), len(prefix)+len(value)+2)
+	copy(newraw, prefix)
+	if value != "" {
+		newraw = append(newraw, QuoteValue(value)...)
+	}
+	t.rawvalue = newraw
+}
+
+// leadingSpace returns the whitespace at the beginning of raw.
+func leadingSpace(raw []byte) []byte {
+	return raw[:len(raw)-len(bytes.TrimLeftFunc(raw, unicode.IsSpace))]
 }
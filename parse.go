@@ -3,6 +3,7 @@ package netrc
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
@@ -10,14 +11,124 @@ import (
 )
 
 // ParseFile opens the file at filename and then passes its io.Reader to
-// Parse().
+// Parse(). The returned Netrc remembers filename so that it can later be
+// written back with Save.
 func ParseFile(filename string) (*Netrc, error) {
+	return ParseFileWithOptions(filename, ParseFileOptions{})
+}
+
+// Dialect selects the variant of the netrc format to parse.
+type Dialect int
+
+const (
+	// DialectNetrc is the traditional netrc format used by ftp(1) and curl.
+	DialectNetrc Dialect = iota
+
+	// DialectAuthinfo is the authinfo format used by Emacs auth-source,
+	// msmtp and offlineimap. It adds the port keyword, with protocol as a
+	// synonym, and allows host for machine and user for login.
+	DialectAuthinfo
+)
+
+func (d Dialect) keywords() map[string]tkType {
+	if d == DialectAuthinfo {
+		return authinfoKeywords
+	}
+	return keywords
+}
+
+// ParseOptions controls the behavior of ParseWithOptions.
+type ParseOptions struct {
+	// Dialect is the variant of the format to accept.
+	Dialect Dialect
+
+	// Lenient causes the parser to skip over problems rather than stop at
+	// the first one. All problems found are returned together as an
+	// ErrorList, along with a Netrc holding everything that could be
+	// parsed. Skipped tokens are kept, so the Netrc's MarshalText output
+	// still matches the input. A field whose value is malformed is left
+	// unset.
+	Lenient bool
+
+	// StrictDuplicates causes a machine to be rejected with
+	// ErrDuplicateMachine if an earlier machine has the same name, port
+	// and login, since only the first of them would ever be used.
+	// Machines for the same host that differ in login are allowed.
+	StrictDuplicates bool
+}
+
+// ParseFileOptions controls the behavior of ParseFileWithOptions.
+type ParseFileOptions struct {
+	ParseOptions
+
+	// StrictPermissions causes the file to be rejected with a
+	// *PermissionError if it contains a password and CheckPermissions
+	// reports a problem with it. This is the check made by ftp(1).
+	StrictPermissions bool
+
+	// Crypter, if not nil, is used to decrypt the file if it is in the
+	// Crypter's encrypted format. The returned Netrc then encrypts its
+	// text with the same Crypter whenever it is written. Files that are
+	// not encrypted are read as usual.
+	Crypter Crypter
+}
+
+// ParseFileWithOptions is like ParseFile but allows additional checks to be
+// requested through opts.
+func ParseFileWithOptions(filename string, opts ParseFileOptions) (*Netrc, error) {
 	fd, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 	defer fd.Close()
-	return Parse(fd)
+
+	var r io.Reader = fd
+	var crypter Crypter
+	if c := opts.Crypter; c != nil {
+		b, err := ioutil.ReadAll(fd)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+		if c.IsEncrypted(b) {
+			// the plaintext is kept in memory only
+			plaintext, err := c.Decrypt(b)
+			if err != nil {
+				return nil, fmt.Errorf("netrc: decrypting %s: %w", filename, err)
+			}
+			r, crypter = bytes.NewReader(plaintext), c
+		}
+	}
+
+	n, err := ParseWithOptions(r, opts.ParseOptions)
+	if n == nil {
+		return nil, err
+	}
+	if opts.StrictPermissions && n.hasPasswords() {
+		fi, err := fd.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkFileInfo(filename, fi); err != nil {
+			return nil, err
+		}
+	}
+	n.path = filename
+	n.crypter = crypter
+	// a lenient parse may return both a Netrc and errors
+	return n, err
+}
+
+// CheckPermissions returns a *PermissionError if the file at filename can be
+// accessed by users other than its owner or is not owned by the current
+// user. Permissions are not checked on Windows or Plan 9, where nil is
+// always returned for an existing file.
+func CheckPermissions(filename string) error {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	return checkFileInfo(filename, fi)
 }
 
 // Parse parses from the the Reader r as a netrc file and returns the set of
@@ -25,115 +136,273 @@ func ParseFile(filename string) (*Netrc, error) {
 // which is intended to be used when no machine name matches, is identified
 // by an empty machine name. There can be only one ``default'' machine.
 //
-// If there is a parsing error, an Error is returned.
+// Values may be enclosed in double quotes so that they can contain spaces or
+// begin with '#'. Within quotes, a backslash escapes the next character.
+//
+// If there is a parsing error, an *Error is returned.
 func Parse(r io.Reader) (*Netrc, error) {
-	return parse(r, 1)
+	return parse(r, 1, ParseOptions{})
 }
 
-func parse(r io.Reader, pos int) (*Netrc, error) {
+// ParseWithOptions is like Parse but allows the dialect and other parser
+// behavior to be selected through opts.
+func ParseWithOptions(r io.Reader, opts ParseOptions) (*Netrc, error) {
+	return parse(r, 1, opts)
+}
+
+func parse(r io.Reader, pos int, opts ParseOptions) (*Netrc, error) {
 	b, err := ioutil.ReadAll(r)
 	if err != nil {
-		return nil, err
+		return nil, &Error{LineNum: pos, Msg: err.Error(), Err: err}
 	}
 
 	nrc := Netrc{machines: make([]*Machine, 0, 20), macros: make(Macros, 10)}
 
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Split(scanTokensKeepPrefix)
+	p := &parser{
+		scanner:  scanner,
+		keywords: opts.Dialect.keywords(),
+		lenient:  opts.Lenient,
+		line:     pos,
+	}
+
 	defaultSeen := false
 	var currentMacro *token
 	var m *Machine
-	var t *token
-	scanner := bufio.NewScanner(bytes.NewReader(b))
-	scanner.Split(scanTokensKeepPrefix)
+	var mpos position
+	seen := make(map[string]bool)
 
-	for scanner.Scan() {
-		rawb := scanner.Bytes()
-		if len(rawb) == 0 {
-			break
+	// finish adds the current machine, if any, to nrc.
+	finish := func() error {
+		if m == nil {
+			return nil
 		}
-		pos += bytes.Count(rawb, []byte{'\n'})
-		t, err = newToken(rawb)
-		if err != nil {
-			if currentMacro == nil {
-				return nil, &Error{pos, err.Error()}
+		if opts.StrictDuplicates && !m.IsDefault() {
+			k := strings.Join([]string{m.Name, m.Port, m.Login}, keysep)
+			if seen[k] {
+				err := fmt.Errorf("%w: %s", ErrDuplicateMachine, m.Name)
+				if err := p.failAt(mpos, m.nametoken.rawvalue, err); err != nil {
+					return err
+				}
+			}
+			seen[k] = true
+		}
+		nrc.machines, m = append(nrc.machines, m), nil
+		return nil
+	}
+
+	// field scans the value of the field token t into the current machine.
+	field := func(t *token) error {
+		var field *string
+		var tp **token
+		if m != nil {
+			field, tp = m.fieldRefs(t.kind)
+		}
+		// password and passwordeval share a token, so either one counts
+		if m == nil || *field != "" || *tp != nil {
+			kind := ErrDuplicateField
+			if m == nil {
+				kind = ErrFieldOutsideMachine
 			}
-			currentMacro.rawvalue = append(currentMacro.rawvalue, rawb...)
-			continue
+			if err := p.fail(t.rawkind, fmt.Errorf("%w: %s", kind, t.keyword())); err != nil {
+				return err
+			}
+			// skip the keyword and its value
+			t.kind = tkInvalid
+			t.rawvalue, _, _ = p.scanValue()
+			return nil
+		}
+		raw, value, err := p.scanValue()
+		if err := p.fail(raw, err); err != nil {
+			return err
 		}
+		if err != nil {
+			// a malformed value is kept as text but never used as the field
+			t.kind = tkInvalid
+			t.rawvalue = raw
+			return nil
+		}
+		t.rawvalue, t.value = raw, value
+		*field, *tp = value, t
+		return nil
+	}
 
-		if currentMacro != nil && bytes.Contains(rawb, []byte{'\n', '\n'}) {
-			// if macro rawvalue + rawb would contain \n\n, then macro def is over
-			currentMacro.value = strings.TrimLeft(string(currentMacro.rawvalue), "\r\n")
-			nrc.macros[currentMacro.macroName] = currentMacro.value
+	for {
+		rawb, ok := p.scan()
+		if !ok {
+			break
+		}
+		if currentMacro != nil {
+			if !endsMacro(rawb) {
+				// everything up to a blank line belongs to the macro, even
+				// words that look like keywords or comments
+				currentMacro.rawvalue = append(currentMacro.rawvalue, rawb...)
+				continue
+			}
+			nrc.finishMacro(currentMacro)
 			currentMacro = nil
 		}
 
+		t, kerr := newDialectToken(rawb, p.keywords)
+		if err := p.fail(rawb, kerr); err != nil {
+			return nil, err
+		}
+		if kerr != nil {
+			t.kind = tkInvalid
+		}
+
 		switch t.kind {
 		case tkMacdef:
-			if _, t.macroName, pos, err = scanValue(scanner, pos); err != nil {
-				return nil, &Error{pos, err.Error()}
+			raw, name, err := p.scanValue()
+			if err := p.fail(raw, err); err != nil {
+				return nil, err
 			}
+			t.macroName = name
 			currentMacro = t
 		case tkDefault:
 			if defaultSeen {
-				return nil, &Error{pos, "multiple default token"}
+				if err := p.fail(rawb, ErrMultipleDefault); err != nil {
+					return nil, err
+				}
 			}
-			if m != nil {
-				nrc.machines, m = append(nrc.machines, m), nil
+			if err := finish(); err != nil {
+				return nil, err
 			}
-			m = new(Machine)
+			m = &Machine{netrc: &nrc, line: p.line}
 			m.Name = ""
+			m.nametoken = t
 			defaultSeen = true
 		case tkMachine:
 			if defaultSeen {
-				return nil, &Error{pos, errBadDefaultOrder}
-			}
-			if m != nil {
-				nrc.machines, m = append(nrc.machines, m), nil
-			}
-			m = new(Machine)
-			if t.rawvalue, m.Name, pos, err = scanValue(scanner, pos); err != nil {
-				return nil, &Error{pos, err.Error()}
-			}
-			t.value = m.Name
-			m.nametoken = t
-		case tkLogin:
-			if m == nil || m.Login != "" {
-				return nil, &Error{pos, "unexpected token login "}
-			}
-			if t.rawvalue, m.Login, pos, err = scanValue(scanner, pos); err != nil {
-				return nil, &Error{pos, err.Error()}
+				if err := p.fail(rawb, ErrBadDefaultOrder); err != nil {
+					return nil, err
+				}
 			}
-			t.value = m.Login
-			m.logintoken = t
-		case tkPassword:
-			if m == nil || m.Password != "" {
-				return nil, &Error{pos, "unexpected token password"}
+			if err := finish(); err != nil {
+				return nil, err
 			}
-			if t.rawvalue, m.Password, pos, err = scanValue(scanner, pos); err != nil {
-				return nil, &Error{pos, err.Error()}
+			m = &Machine{netrc: &nrc, line: p.line}
+			raw, name, err := p.scanValue()
+			mpos = p.pos()
+			if err := p.fail(raw, err); err != nil {
+				return nil, err
 			}
-			t.value = m.Password
-			m.passtoken = t
-		case tkAccount:
-			if m == nil || m.Account != "" {
-				return nil, &Error{pos, "unexpected token account"}
+			t.rawvalue, t.value = raw, name
+			m.Name, m.nametoken = name, t
+		case tkLogin, tkPassword, tkPasswordEval, tkAccount, tkPort:
+			if err := field(t); err != nil {
+				return nil, err
 			}
-			if t.rawvalue, m.Account, pos, err = scanValue(scanner, pos); err != nil {
-				return nil, &Error{pos, err.Error()}
-			}
-			t.value = m.Account
-			m.accounttoken = t
 		}
 
 		nrc.tokens = append(nrc.tokens, t)
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, err
+		return nil, &Error{LineNum: p.line, Offset: p.offset, Msg: err.Error(), Err: err}
 	}
 
-	if m != nil {
-		nrc.machines, m = append(nrc.machines, m), nil
+	if currentMacro != nil {
+		nrc.finishMacro(currentMacro)
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	if len(p.errs) > 0 {
+		return &nrc, p.errs
 	}
 	return &nrc, nil
 }
+
+// parser tracks the position of each token scanned and collects errors in
+// lenient mode.
+type parser struct {
+	scanner  *bufio.Scanner
+	keywords map[string]tkType
+	lenient  bool
+	errs     ErrorList
+
+	line      int // line number of the last token scanned
+	offset    int // byte offset just past the last token scanned
+	lineStart int // byte offset of the line holding the last token
+	tokStart  int // byte offset of the last token, not counting its prefix
+}
+
+// scan returns the next raw token, including any whitespace before it.
+func (p *parser) scan() ([]byte, bool) {
+	if !p.scanner.Scan() {
+		return nil, false
+	}
+	raw := p.scanner.Bytes()
+	if len(raw) == 0 {
+		return nil, false
+	}
+	prefix := leadingSpace(raw)
+	if i := bytes.LastIndexByte(prefix, '\n'); i >= 0 {
+		p.lineStart = p.offset + i + 1
+	}
+	p.line += bytes.Count(raw, []byte{'\n'})
+	p.tokStart = p.offset + len(prefix)
+	p.offset += len(raw)
+	return raw, true
+}
+
+// scanValue scans the value following a keyword. If the value is malformed,
+// its raw text is used as the value and an error is returned as well.
+func (p *parser) scanValue() (raw []byte, value string, err error) {
+	raw, ok := p.scan()
+	if !ok {
+		return nil, "", nil
+	}
+	trimmed := string(bytes.TrimSpace(raw))
+	if value, err = unquoteValue(trimmed); err != nil {
+		return raw, trimmed, err
+	}
+	return raw, value, nil
+}
+
+// fail reports err, a problem with the token raw, the last one scanned; a
+// nil err is ignored. In lenient mode the problem is recorded and fail
+// returns nil so that parsing can continue; otherwise it is returned as an
+// *Error.
+func (p *parser) fail(raw []byte, err error) error {
+	return p.failAt(p.pos(), raw, err)
+}
+
+// position is the location of a token in the input.
+type position struct {
+	line, column, offset int
+}
+
+// pos returns the position of the last token scanned.
+func (p *parser) pos() position {
+	return position{line: p.line, column: p.tokStart - p.lineStart + 1, offset: p.tokStart}
+}
+
+// failAt is like fail but reports the problem at pos rather than at the
+// last token scanned.
+func (p *parser) failAt(pos position, raw []byte, err error) error {
+	if err == nil {
+		return nil
+	}
+	e := &Error{
+		LineNum: pos.line,
+		Column:  pos.column,
+		Offset:  pos.offset,
+		Token:   string(bytes.TrimSpace(raw)),
+		Msg:     err.Error(),
+		Err:     err,
+	}
+	if !p.lenient {
+		return e
+	}
+	p.errs = append(p.errs, e)
+	return nil
+}
+
+// endsMacro reports whether rawb, the raw bytes of the token following a
+// macro definition, begins with the blank line that ends the definition.
+func endsMacro(rawb []byte) bool {
+	return bytes.Contains(rawb, []byte("\n\n")) || bytes.Contains(rawb, []byte("\n\r\n"))
+}
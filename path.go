@@ -0,0 +1,64 @@
+package netrc
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// These are variables so that tests can substitute their own environment.
+var (
+	getenv      = os.Getenv
+	userHomeDir = os.UserHomeDir
+	goos        = runtime.GOOS
+)
+
+// DefaultPath returns the location of the current user's netrc file. If the
+// NETRC environment variable is set, its value is returned. Otherwise,
+// ".netrc" and then "_netrc" are looked for in the user's home directory and
+// the first that exists is returned. If neither exists, the conventional name
+// for the platform is returned (".netrc", or "_netrc" on Windows), so that a
+// new file can be created there.
+//
+// This is the same search performed by curl and cmd/go.
+func DefaultPath() (string, error) {
+	if p := getenv("NETRC"); p != "" {
+		return p, nil
+	}
+
+	home, err := userHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	names := []string{".netrc", "_netrc"}
+	for _, name := range names {
+		p := filepath.Join(home, name)
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	if goos == "windows" {
+		return filepath.Join(home, names[1]), nil
+	}
+	return filepath.Join(home, names[0]), nil
+}
+
+// ParseDefault parses the netrc file found by DefaultPath.
+func ParseDefault() (*Netrc, error) {
+	p, err := DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	return ParseFile(p)
+}
+
+// FindMachineDefault parses the netrc file found by DefaultPath and returns
+// the Machine named by name, as with FindMachine.
+func FindMachineDefault(name string) (*Machine, error) {
+	p, err := DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	return FindMachine(p, name)
+}
@@ -0,0 +1,183 @@
+package netrc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentAccess exercises every public read and write path from
+// multiple goroutines at once. It is most useful when run with -race.
+func TestConcurrentAccess(t *testing.T) {
+	n, err := ParseFile("testdata/good.netrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ParseFile("testdata/other.netrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const workers, rounds = 4, 50
+	var wg sync.WaitGroup
+	run := func(f func(w, i int)) {
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < rounds; i++ {
+					f(w, i)
+				}
+			}(w)
+		}
+	}
+
+	// readers
+	run(func(w, i int) {
+		n.FindMachine("ray")
+		n.FindMachine("nonexistent")
+		if _, err := n.MarshalText(); err != nil {
+			t.Error(err)
+		}
+		n.Equal(other)
+		other.Equal(n)
+		n.Macros()
+		n.Macro("allput")
+		n.Path()
+		n.Visit(func(m *Machine) error { return nil })
+	})
+	run(func(w, i int) {
+		s := n.Snapshot()
+		for _, m := range s.machines {
+			_ = m.Name + m.Login + m.Password + m.Account
+		}
+		if _, err := s.MarshalText(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	// writers
+	run(func(w, i int) {
+		name := fmt.Sprintf("host%d-%d", w, i)
+		m := n.NewMachine(name, "login", "", "")
+		m.UpdatePassword("password")
+		m.UpdateLogin("newlogin")
+		m.UpdateAccount("account")
+		m.RemoveAccount()
+		m.Equal(m)
+		n.RemoveMachine(name)
+	})
+	run(func(w, i int) {
+		name := fmt.Sprintf("macro%d-%d", w, i)
+		if err := n.NewMacro(name, "put a"); err != nil {
+			t.Error(err)
+		}
+		if err := n.UpdateMacro(name, "put b"); err != nil {
+			t.Error(err)
+		}
+		n.RemoveMacro(name)
+	})
+	run(func(w, i int) {
+		n.FindMachine("ray").UpdatePassword(fmt.Sprintf("pass%d", i))
+		n.Visit(func(m *Machine) error {
+			if m.Name == "weirdlogin" {
+				m.UpdateAccount(fmt.Sprintf("acct%d", w))
+			}
+			return nil
+		})
+	})
+
+	wg.Wait()
+
+	if len(n.machines) != len(expectedMachines) {
+		t.Errorf("expected %d machines, got %d", len(expectedMachines), len(n.machines))
+	}
+	if len(n.macros) != len(expectedMacros) {
+		t.Errorf("expected %d macros, got %d", len(expectedMacros), len(n.macros))
+	}
+}
+
+// TestConcurrentLayers saves and reads Layers from multiple goroutines at
+// once. It is most useful when run with -race.
+func TestConcurrentLayers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var files []string
+	for i, text := range []string{"machine a login x password p\n", "machine b login y password q\n"} {
+		path := filepath.Join(dir, fmt.Sprintf("layer%d", i))
+		if err := ioutil.WriteFile(path, []byte(text), 0600); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+	l, err := ParseLayers(LastMatchWins, files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const workers, rounds = 4, 20
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				l.FindMachine("a").UpdatePassword(fmt.Sprintf("pass%d-%d", w, i))
+				l.FindMachine("b")
+				l.Visit(func(m *Machine) error { return nil })
+				if err := l.Save(); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if err := l.Save(); err != nil {
+		t.Fatal(err)
+	}
+	n, err := ParseFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := n.FindMachine("a").Password, l.FindMachine("a").Password; got != want {
+		t.Errorf("expected saved password %q, got %q", want, got)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	n, err := ParseFile("testdata/good.netrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := n.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := n.Snapshot()
+	n.FindMachine("ray").UpdatePassword("changed")
+	n.RemoveMachine("weirdlogin")
+	n.NewMacro("added", "put a")
+
+	after, err := s.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("snapshot changed; expected:\n%q\ngot:\n%q", before, after)
+	}
+	testExpected(s, t)
+
+	// changes to the snapshot don't affect the original either
+	s.FindMachine("mail.google.com").UpdateLogin("other@gmail.com")
+	if m := n.FindMachine("mail.google.com"); m.Login != expectedMachines[0].Login {
+		t.Errorf("expected original login %q, got %q", expectedMachines[0].Login, m.Login)
+	}
+}
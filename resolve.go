@@ -0,0 +1,182 @@
+package netrc
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// A SecretResolver maps a password that refers to a secret kept elsewhere,
+// such as in an environment variable, to the secret itself. Resolution is
+// opt-in: a password is only resolved when a SecretResolver is passed to
+// Machine.ResolvePassword or set on a Transport. The file itself always
+// keeps the reference, so MarshalText and Save never write out a resolved
+// secret.
+type SecretResolver interface {
+	// ResolveSecret returns the secret that value refers to. A value that
+	// is not a reference the resolver understands is returned unchanged.
+	ResolveSecret(value string) (string, error)
+}
+
+// StandardResolver is a SecretResolver that understands these references:
+//
+//	env:NAME      the value of the environment variable NAME
+//	file:PATH     the contents of the file at PATH, without trailing newlines
+//	cmd:COMMAND   the first line written by COMMAND, run by the shell
+//
+// The cmd: form works like msmtp's passwordeval, as in
+//
+//	machine smtp.example.com login me password "cmd:pass show smtp"
+//
+// msmtp's own keyword may be used instead, in which case the command is the
+// machine's PasswordEval and its Password is empty:
+//
+//	machine smtp.example.com login me passwordeval "pass show smtp"
+//
+// Since it runs whatever command the file names, it must be enabled with
+// AllowCommands.
+type StandardResolver struct {
+	// AllowCommands enables cmd: references.
+	AllowCommands bool
+}
+
+// ResolveSecret implements the SecretResolver interface.
+func (r StandardResolver) ResolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+
+	case strings.HasPrefix(value, "file:"):
+		b, err := ioutil.ReadFile(strings.TrimPrefix(value, "file:"))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+
+	case strings.HasPrefix(value, "cmd:"):
+		command := strings.TrimPrefix(value, "cmd:")
+		if !r.AllowCommands {
+			return "", fmt.Errorf("command %q not run: commands are not allowed", command)
+		}
+		return runCommand(command)
+	}
+	return value, nil
+}
+
+// runCommand runs command with the shell and returns the first line of its
+// output.
+func runCommand(command string) (string, error) {
+	cmd := exec.Command("/bin/sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("command %q: %w: %s", command, err, msg)
+		}
+		return "", fmt.Errorf("command %q: %w", command, err)
+	}
+	line := string(out)
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+// ResolvePassword returns m's password as resolved by r. A password given
+// with passwordeval is passed to r as a cmd: reference. If r is nil, the
+// password is returned as written, except that a passwordeval command is
+// never mistaken for a password. Errors are returned as a *SecretError that
+// identifies m.
+func (m *Machine) ResolvePassword(r SecretResolver) (string, error) {
+	c, ref, eval := m.passwordRef()
+	var secret string
+	var err error
+	switch {
+	case r != nil:
+		secret, err = r.ResolveSecret(ref)
+	case eval:
+		err = fmt.Errorf("passwordeval %q needs a SecretResolver", c.PasswordEval)
+	default:
+		secret = c.Password
+	}
+	if err != nil {
+		path, line := m.Source()
+		return "", &SecretError{Machine: c.Name, Path: path, Line: line, Err: err}
+	}
+	return secret, nil
+}
+
+// passwordRef returns a shallow copy of m and the reference its password
+// makes, which is its Password unless eval reports that it has a
+// PasswordEval command.
+func (m *Machine) passwordRef() (c *Machine, ref string, eval bool) {
+	if n := m.netrc; n != nil {
+		n.updateLock.RLock()
+		defer n.updateLock.RUnlock()
+	}
+	cm := *m
+	if cm.PasswordEval != "" {
+		return &cm, "cmd:" + cm.PasswordEval, true
+	}
+	return &cm, cm.Password, false
+}
+
+// resolved returns a copy of m, with its password resolved by r, that does
+// not belong to any Netrc, so that the reference in the file is kept.
+func (m *Machine) resolved(r SecretResolver) (*Machine, error) {
+	secret, err := m.ResolvePassword(r)
+	if err != nil {
+		return nil, err
+	}
+	c := m.snapshot()
+	return &Machine{
+		Name:     c.Name,
+		Login:    c.Login,
+		Password: secret,
+		Account:  c.Account,
+		Port:     c.Port,
+		line:     c.line,
+	}, nil
+}
+
+// ResolveMachine is like FindMachineWithOptions but resolves the password
+// of the Machine found with r. The returned Machine is a copy that does not
+// belong to n, so n and its text keep the reference rather than the secret.
+// It returns nil, nil if no machine is found.
+func (n *Netrc) ResolveMachine(name string, opts LookupOptions, r SecretResolver) (*Machine, error) {
+	m, _ := n.FindMachineWithOptions(name, opts)
+	if m == nil {
+		return nil, nil
+	}
+	return m.resolved(r)
+}
+
+// ResolveURL is like LookupURLWithOptions but resolves the password of the
+// Machine found with r, as ResolveMachine does. The returned *url.Userinfo
+// holds the resolved password. It returns nil, nil, nil if no machine is
+// found.
+func (n *Netrc) ResolveURL(u *url.URL, opts LookupOptions, r SecretResolver) (*Machine, *url.Userinfo, error) {
+	m, _, _ := n.LookupURLWithOptions(u, opts)
+	if m == nil {
+		return nil, nil, nil
+	}
+	c, err := m.resolved(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, c.userinfo(), nil
+}
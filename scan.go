@@ -20,16 +20,37 @@ const (
 	tkMacdef
 	tkComment
 	tkWhitespace
+	tkPort
+	tkInvalid      // unparseable text kept by a lenient parse
+	tkPasswordEval // msmtp's command form of password, see StandardResolver
 )
 
 var keywords = map[string]tkType{
-	"machine":  tkMachine,
-	"default":  tkDefault,
-	"login":    tkLogin,
-	"password": tkPassword,
-	"account":  tkAccount,
-	"macdef":   tkMacdef,
-	"#":        tkComment,
+	"machine":      tkMachine,
+	"default":      tkDefault,
+	"login":        tkLogin,
+	"password":     tkPassword,
+	"passwordeval": tkPasswordEval,
+	"account":      tkAccount,
+	"macdef":       tkMacdef,
+	"#":            tkComment,
+}
+
+// authinfoKeywords are the keywords of the authinfo dialect used by Emacs
+// auth-source, msmtp and others.
+var authinfoKeywords = map[string]tkType{
+	"machine":      tkMachine,
+	"host":         tkMachine,
+	"default":      tkDefault,
+	"login":        tkLogin,
+	"user":         tkLogin,
+	"password":     tkPassword,
+	"passwordeval": tkPasswordEval,
+	"account":      tkAccount,
+	"port":         tkPort,
+	"protocol":     tkPort,
+	"macdef":       tkMacdef,
+	"#":            tkComment,
 }
 
 type token struct {
@@ -40,7 +61,16 @@ type token struct {
 	rawvalue  []byte
 }
 
+// keyword returns the keyword that t was written with.
+func (t *token) keyword() string {
+	return string(bytes.TrimSpace(t.rawkind))
+}
+
 func newToken(rawb []byte) (*token, error) {
+	return newDialectToken(rawb, keywords)
+}
+
+func newDialectToken(rawb []byte, keywords map[string]tkType) (*token, error) {
 	_, tkind, err := bufio.ScanWords(rawb, true)
 	if err != nil {
 		return nil, err
@@ -58,7 +88,7 @@ func newToken(rawb []byte) (*token, error) {
 			t.kind = tkComment // this is a comment
 			return &t, nil
 		}
-		return &t, fmt.Errorf("keyword expected; got " + string(tkind))
+		return &t, fmt.Errorf("%w; got %s", ErrUnknownKeyword, tkind)
 	}
 	return &t, nil
 }
@@ -115,6 +145,9 @@ func scanTokensKeepPrefix(data []byte, atEOF bool) (advance int, token []byte, e
 	if len(data) > start && data[start] == '#' {
 		return scanLinesKeepPrefix(data, atEOF)
 	}
+	if len(data) > start && data[start] == '"' {
+		return scanQuotedKeepPrefix(data, start, atEOF)
+	}
 	// Scan until space, marking end of word.
 	for width, i := 0, start; i < len(data); i += width {
 		var r rune
@@ -131,14 +164,97 @@ func scanTokensKeepPrefix(data []byte, atEOF bool) (advance int, token []byte, e
 	return 0, nil, nil
 }
 
-func scanValue(scanner *bufio.Scanner, pos int) ([]byte, string, int, error) {
-	if scanner.Scan() {
-		raw := scanner.Bytes()
-		pos += bytes.Count(raw, []byte{'\n'})
-		return raw, strings.TrimSpace(string(raw)), pos, nil
+// scanQuotedKeepPrefix is the counterpart to scanTokensKeepPrefix for a
+// double-quoted word beginning at data[start]. The returned token ends with
+// the closing quote. A quoted word may not span lines; if a newline is found
+// before the closing quote, the token ends just before the newline and
+// unquoteValue will later report it as unterminated.
+func scanQuotedKeepPrefix(data []byte, start int, atEOF bool) (advance int, token []byte, err error) {
+	for i := start + 1; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			if i+1 < len(data) && data[i+1] != '\n' {
+				i++
+			}
+		case '"':
+			return i + 1, data[:i+1], nil
+		case '\n':
+			return i, data[:i], nil
+		}
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, "", pos, &Error{pos, err.Error()}
+	if atEOF {
+		return len(data), data, nil
 	}
-	return nil, "", pos, nil
+	// Request more data.
+	return 0, nil, nil
+}
+
+// unquoteValue returns the value represented by the word s. Words that are
+// not double-quoted are returned unchanged. Inside a quoted word, a backslash
+// escapes the following character; \n, \r and \t stand for newline,
+// carriage return and tab as they do for curl.
+func unquoteValue(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			if i == len(s)-1 {
+				return b.String(), nil
+			}
+			return "", fmt.Errorf("%w: unexpected quote", ErrBadQuote)
+		case '\\':
+			if i++; i == len(s) {
+				break
+			}
+			switch c = s[i]; c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("%w: missing closing quote", ErrBadQuote)
+}
+
+// QuoteValue returns value in the form it must take in a netrc file to be
+// read back as a single token with that value. Values that would otherwise
+// be misread (those that are empty or contain spaces, quotes or
+// backslashes, or that begin with '#') are double-quoted; all others are
+// returned as-is.
+func QuoteValue(value string) string {
+	if value != "" && !strings.HasPrefix(value, "#") && strings.IndexFunc(value, needsQuote) < 0 {
+		return value
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func needsQuote(r rune) bool {
+	return r == '"' || r == '\\' || unicode.IsSpace(r)
 }
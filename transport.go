@@ -0,0 +1,119 @@
+package netrc
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Transport is an http.RoundTripper that adds HTTP Basic authentication to
+// requests using the credentials in a Netrc.
+//
+// Credentials are added only to requests that have no Authorization header,
+// and only from a machine whose name matches the request's host; the
+// ``default'' machine is never used. As with curl, credentials are not added
+// to a request that is the result of a redirect to a different host or port.
+type Transport struct {
+	// Netrc holds the credentials to use. It must not be nil.
+	Netrc *Netrc
+
+	// Base is the RoundTripper used to send requests. If nil,
+	// http.DefaultTransport is used.
+	Base http.RoundTripper
+
+	// AllowHTTP permits credentials to be sent over plain HTTP. If false,
+	// a request to a non-HTTPS URL for which credentials exist fails
+	// rather than send them unencrypted.
+	AllowHTTP bool
+
+	// Resolver, if not nil, resolves passwords that refer to secrets kept
+	// elsewhere; see SecretResolver. A password that cannot be resolved
+	// causes the request to fail, as does a passwordeval password when
+	// Resolver is nil.
+	Resolver SecretResolver
+}
+
+// ErrInsecureTransport is returned by Transport.RoundTrip for a plain HTTP
+// request that would carry credentials when AllowHTTP is not set.
+var ErrInsecureTransport = errors.New("netrc: refusing to send credentials over plain HTTP")
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" || isCrossHostRedirect(req) {
+		return t.base().RoundTrip(req)
+	}
+
+	var user string
+	if req.URL.User != nil {
+		user = req.URL.User.Username()
+	}
+	t.Netrc.updateLock.RLock()
+	var login string
+	m, _ := t.Netrc.lookupHost(req.URL.Hostname(), user, &LookupOptions{DisableDefault: true})
+	if m != nil {
+		login = m.Login
+	}
+	t.Netrc.updateLock.RUnlock()
+
+	if m == nil {
+		return t.base().RoundTrip(req)
+	}
+	if req.URL.Scheme != "https" && !t.AllowHTTP {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, ErrInsecureTransport
+	}
+
+	// with a nil Resolver this only rejects passwordeval commands
+	password, err := m.ResolvePassword(t.Resolver)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	// a RoundTripper must not modify the request it is given
+	r2 := new(http.Request)
+	*r2 = *req
+	r2.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r2.Header[k] = append([]string(nil), v...)
+	}
+	r2.SetBasicAuth(login, password)
+	return t.base().RoundTrip(r2)
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// isCrossHostRedirect reports whether req was made by following a redirect
+// from a request to a different host or port.
+func isCrossHostRedirect(req *http.Request) bool {
+	orig := req
+	for orig.Response != nil && orig.Response.Request != nil {
+		orig = orig.Response.Request
+	}
+	return orig != req && !equalHostPort(orig, req)
+}
+
+func equalHostPort(a, b *http.Request) bool {
+	return hostMatches(a.URL.Hostname(), b.URL.Hostname()) && urlPort(a) == urlPort(b)
+}
+
+func urlPort(req *http.Request) string {
+	if p := req.URL.Port(); p != "" {
+		return p
+	}
+	switch req.URL.Scheme {
+	case "https":
+		return "443"
+	case "http":
+		return "80"
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+package netrc
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func authEcho(w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		io.WriteString(w, "none")
+		return
+	}
+	fmt.Fprintf(w, "%s:%s", user, pass)
+}
+
+func get(t *testing.T, c *http.Client, url string) string {
+	t.Helper()
+	resp, err := c.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestTransport(t *testing.T) {
+	other := httptest.NewTLSServer(http.HandlerFunc(authEcho))
+	defer other.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", authEcho)
+	mux.HandleFunc("/local", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/echo", http.StatusFound)
+	})
+	mux.HandleFunc("/away", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other.URL+"/echo", http.StatusFound)
+	})
+	srv := httptest.NewTLSServer(mux)
+	defer srv.Close()
+
+	n, err := Parse(strings.NewReader("machine 127.0.0.1 login joe password secret\ndefault login anonymous password guest\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &http.Client{Transport: &Transport{Netrc: n, Base: srv.Client().Transport}}
+
+	if got := get(t, c, srv.URL+"/echo"); got != "joe:secret" {
+		t.Errorf("expected credentials joe:secret, got %q", got)
+	}
+	if got := get(t, c, srv.URL+"/local"); got != "joe:secret" {
+		t.Errorf("expected credentials after same-host redirect, got %q", got)
+	}
+	if got := get(t, c, srv.URL+"/away"); got != "none" {
+		t.Errorf("expected no credentials after cross-host redirect, got %q", got)
+	}
+
+	req, err := http.NewRequest("GET", srv.URL+"/echo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("explicit", "auth")
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "explicit:auth" {
+		t.Errorf("expected existing Authorization header to be kept, got %q", b)
+	}
+
+	plain := httptest.NewServer(http.HandlerFunc(authEcho))
+	defer plain.Close()
+	if _, err := c.Get(plain.URL); err == nil || !strings.Contains(err.Error(), ErrInsecureTransport.Error()) {
+		t.Errorf("expected %v for plain HTTP, got %v", ErrInsecureTransport, err)
+	}
+	c.Transport.(*Transport).AllowHTTP = true
+	if got := get(t, c, plain.URL); got != "joe:secret" {
+		t.Errorf("expected credentials over allowed HTTP, got %q", got)
+	}
+
+	n, err = Parse(strings.NewReader("default login anonymous password guest\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = &http.Client{Transport: &Transport{Netrc: n, Base: srv.Client().Transport}}
+	if got := get(t, c, srv.URL+"/echo"); got != "none" {
+		t.Errorf("expected default machine to be ignored, got %q", got)
+	}
+
+	os.Setenv("NETRC_TEST_TOKEN", "resolved")
+	defer os.Unsetenv("NETRC_TEST_TOKEN")
+	n, err = Parse(strings.NewReader("machine 127.0.0.1 login joe password env:NETRC_TEST_TOKEN\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = &http.Client{Transport: &Transport{Netrc: n, Base: srv.Client().Transport, Resolver: StandardResolver{}}}
+	if got := get(t, c, srv.URL+"/echo"); got != "joe:resolved" {
+		t.Errorf("expected resolved credentials joe:resolved, got %q", got)
+	}
+}
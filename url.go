@@ -0,0 +1,78 @@
+package netrc
+
+import (
+	"net/url"
+	"strings"
+)
+
+// LookupURL returns the Machine in n that holds the credentials for u, along
+// with those credentials as a *url.Userinfo. It follows the same rules as
+// curl: the port is ignored, host names are compared without regard to case
+// and IPv6 literals match whether or not the machine name is written with
+// brackets. If u includes a user name, only a machine with a matching login
+// is returned; the credentials of another user are never substituted.
+//
+// If no machine matches and there is a ``default'' machine, it is returned as
+// with FindMachine. If nothing matches, LookupURL returns nil, nil.
+func (n *Netrc) LookupURL(u *url.URL) (*Machine, *url.Userinfo) {
+	m, ui, _ := n.LookupURLWithOptions(u, LookupOptions{})
+	return m, ui
+}
+
+// LookupURLWithOptions is like LookupURL but uses opts to decide whether the
+// ``default'' machine may be returned for u's host, as FindMachineWithOptions
+// does. The returned MatchKind tells how the Machine was found.
+func (n *Netrc) LookupURLWithOptions(u *url.URL, opts LookupOptions) (*Machine, *url.Userinfo, MatchKind) {
+	n.updateLock.RLock()
+	defer n.updateLock.RUnlock()
+
+	var user string
+	if u.User != nil {
+		user = u.User.Username()
+	}
+	m, kind := n.lookupHost(u.Hostname(), user, &opts)
+	if m == nil {
+		return nil, nil, NoMatch
+	}
+	return m, m.userinfo(), kind
+}
+
+// lookupHost returns the first machine in n whose name matches host and,
+// if user is not empty, whose login is user. If there is no match and opts
+// allow it for host, the ``default'' machine is returned, as long as its
+// login is user or user is empty. The caller must hold n's lock.
+func (n *Netrc) lookupHost(host, user string, opts *LookupOptions) (*Machine, MatchKind) {
+	var def *Machine
+	for _, m := range n.machines {
+		if user != "" && m.Login != user {
+			continue
+		}
+		switch {
+		case m.IsDefault():
+			def = m
+		case hostMatches(m.Name, host):
+			return m, ExactMatch
+		}
+	}
+	if def == nil || !opts.allowsDefault(host) {
+		return nil, NoMatch
+	}
+	return def, DefaultMatch
+}
+
+// userinfo returns m's login and password as a *url.Userinfo.
+func (m *Machine) userinfo() *url.Userinfo {
+	if m.Password == "" {
+		return url.User(m.Login)
+	}
+	return url.UserPassword(m.Login, m.Password)
+}
+
+// hostMatches reports whether the machine name name refers to host, which
+// is a host name as returned by url.URL.Hostname.
+func hostMatches(name, host string) bool {
+	if strings.HasPrefix(name, "[") && strings.HasSuffix(name, "]") {
+		name = name[1 : len(name)-1]
+	}
+	return name != "" && strings.EqualFold(name, host)
+}